@@ -0,0 +1,91 @@
+package wikidump
+
+import (
+	"io"
+	"os/exec"
+
+	"github.com/kjk/lzmadec"
+	"github.com/pkg/errors"
+)
+
+// Entry is a file stored in an archive.
+type Entry struct {
+	Path string
+	Size int64
+}
+
+// Archiver lists and extracts the content of the 7z archives stored on disk.
+type Archiver interface {
+	List(path string) ([]Entry, error)
+	Open(path string, entry Entry) (io.ReadCloser, error)
+}
+
+// WithArchiver sets the Archiver used to extract 7z archives, by default it's backed by the lzmadec binary (7z).
+func WithArchiver(archiver Archiver) Option {
+	return func(w *Wikidump) error {
+		if archiver == nil {
+			return errors.New("Error: nil archiver")
+		}
+		w.archiver = archiver
+		return nil
+	}
+}
+
+// WithArchiveEntry sets the name of the entry extracted from 7z archives storing more than one, matching either
+// its path or its base name. By default archives must store a single entry.
+func WithArchiveEntry(name string) Option {
+	return func(w *Wikidump) error {
+		if name == "" {
+			return errors.New("Error: empty archive entry")
+		}
+		w.archiveEntry = name
+		return nil
+	}
+}
+
+// lzmadecArchiver is the default Archiver, it relies on the 7z binary through lzmadec.
+// It keeps the last archive listed, so that opening one of its entries doesn't list it again:
+// a new one is used for each extraction, so it's not safe for concurrent use.
+type lzmadecArchiver struct {
+	path    string
+	archive *lzmadec.Archive
+}
+
+// Err7zNotFound is returned when the 7z executable needed by the default Archiver is not installed.
+var Err7zNotFound = errors.New("7z executable not found, install p7zip or set an Archiver with WithArchiver")
+
+// lzmadecError annotates err, returned by lzmadec while doing something with the file at path.
+func lzmadecError(err error, doing, path string) error {
+	if errors.Is(err, exec.ErrNotFound) {
+		return errors.Wrapf(Err7zNotFound, "Error while %v file %v", doing, path)
+	}
+	return errors.Wrapf(err, "%v while %v file %v", lzmadecErr2Meaning(err), doing, path)
+}
+
+func (a *lzmadecArchiver) List(path string) ([]Entry, error) {
+	archive, err := lzmadec.NewArchive(path)
+	if err != nil {
+		return nil, lzmadecError(err, "listing content of", path)
+	}
+	a.path, a.archive = path, archive
+	entries := make([]Entry, len(archive.Entries))
+	for i, e := range archive.Entries {
+		entries[i] = Entry{e.Path, e.Size}
+	}
+	return entries, nil
+}
+
+func (a *lzmadecArchiver) Open(path string, entry Entry) (io.ReadCloser, error) {
+	archive := a.archive
+	if a.path != path || archive == nil {
+		var err error
+		if archive, err = lzmadec.NewArchive(path); err != nil {
+			return nil, lzmadecError(err, "listing content of", path)
+		}
+	}
+	r, err := archive.GetFileReader(entry.Path)
+	if err != nil {
+		return nil, lzmadecError(err, "opening", path)
+	}
+	return r, nil
+}
@@ -0,0 +1,195 @@
+package wikidump
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeArchiver pretends that every archive stores helloword.
+type fakeArchiver struct {
+	listed []string
+}
+
+func (a *fakeArchiver) List(path string) ([]Entry, error) {
+	a.listed = append(a.listed, path)
+	return []Entry{{"helloword.txt", int64(len(helloword))}}, nil
+}
+
+func (a *fakeArchiver) Open(path string, entry Entry) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader(helloword)), nil
+}
+
+func TestArchiver(t *testing.T) {
+	server, _ := countingServer()
+	defer server.Close()
+
+	archiver := &fakeArchiver{}
+	tDump, err := Wikidump{}.With(WithArchiver(archiver))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	fi := fileInfo{URL: server.URL + "/helloword.7z", SHA1: name2MyInfo["/helloword.7z"].SHA1}
+	r, err := tDump.open(context.Background(), fi)
+	if err != nil {
+		t.Fatal("open returns ", err)
+	}
+	defer r.Close()
+	if data, err := ioutil.ReadAll(r); err != nil || string(data) != helloword {
+		t.Error("Reading returns ", string(data), err)
+	}
+	if len(archiver.listed) != 1 {
+		t.Error("The archiver should list one file, while it lists ", archiver.listed)
+	}
+}
+
+// blockingArchiver stores archives whose content is helloword followed by a read blocking until Close.
+type blockingArchiver struct {
+	closed chan struct{}
+}
+
+func (a blockingArchiver) List(path string) ([]Entry, error) {
+	return []Entry{{"helloword.txt", -1}}, nil
+}
+
+func (a blockingArchiver) Open(path string, entry Entry) (io.ReadCloser, error) {
+	return blockingReader{strings.NewReader(helloword), a.closed}, nil
+}
+
+type blockingReader struct {
+	r      io.Reader
+	closed chan struct{}
+}
+
+func (b blockingReader) Read(p []byte) (int, error) {
+	if n, _ := b.r.Read(p); n > 0 {
+		return n, nil
+	}
+	<-b.closed
+	return 0, errors.New("read from a closed archive")
+}
+
+func (b blockingReader) Close() error {
+	close(b.closed)
+	return nil
+}
+
+func TestArchiverCancel(t *testing.T) {
+	server, _ := countingServer()
+	defer server.Close()
+
+	tmpDir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	archiver := blockingArchiver{make(chan struct{})}
+	tDump, err := Wikidump{tmpDir: tmpDir}.With(WithArchiver(archiver))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r, err := tDump.open(ctx, fileInfo{URL: server.URL + "/helloword.7z", SHA1: name2MyInfo["/helloword.7z"].SHA1})
+	if err != nil {
+		t.Fatal("open returns ", err)
+	}
+
+	p := make([]byte, len(helloword))
+	if _, err := io.ReadFull(r, p); err != nil || string(p) != helloword {
+		t.Error("Reading returns ", string(p), err)
+	}
+	//the next read blocks until the context is done
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := r.Read(p); !errors.Is(err, context.Canceled) {
+		t.Error("Reading should fail once the context is done, while it returns ", err)
+	}
+
+	select {
+	case <-archiver.closed:
+	case <-time.After(time.Second):
+		t.Error("The archive should be closed once the context is done")
+	}
+	//Close waits for the cleanup in progress
+	if err := r.Close(); err != nil {
+		t.Error("Closing returns ", err)
+	}
+	if leftovers, _ := ioutil.ReadDir(tmpDir); len(leftovers) > 0 {
+		t.Error("The temporary file should be removed once the context is done")
+	}
+}
+
+func TestMissing7z(t *testing.T) {
+	_, err := exec.Command("wikidump-missing-7z").Output()
+	if !errors.Is(err, exec.ErrNotFound) {
+		t.Skip("unable to simulate a missing executable: ", err)
+	}
+	err = lzmadecError(err, "listing content of", "helloword.7z")
+	if !errors.Is(err, Err7zNotFound) || !strings.Contains(err.Error(), "helloword.7z") || !strings.Contains(err.Error(), "p7zip") {
+		t.Error("A missing 7z should be reported with Err7zNotFound, while the error is ", err)
+	}
+
+	exitErr := exec.Command("false").Run()
+	if err := lzmadecError(exitErr, "opening", "helloword.7z"); errors.Is(err, Err7zNotFound) || !strings.Contains(err.Error(), "while opening file helloword.7z") {
+		t.Error("Other errors should be annotated as before, while the error is ", err)
+	}
+}
+
+// multiArchiver stores archives with two entries, whose content is their path.
+type multiArchiver struct{}
+
+func (multiArchiver) List(path string) ([]Entry, error) {
+	return []Entry{{"dump/one.xml", 12}, {"dump/two.xml", 12}}, nil
+}
+
+func (multiArchiver) Open(path string, entry Entry) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader(entry.Path)), nil
+}
+
+func TestArchiveEntry(t *testing.T) {
+	server, _ := countingServer()
+	defer server.Close()
+	fi := fileInfo{URL: server.URL + "/helloword.7z", SHA1: name2MyInfo["/helloword.7z"].SHA1}
+
+	for _, tc := range []struct {
+		entry, content, errContains string
+	}{
+		{"", "", "dump/one.xml, dump/two.xml"},
+		{"two.xml", "dump/two.xml", ""},
+		{"dump/one.xml", "dump/one.xml", ""},
+		{"three.xml", "", "entry three.xml not found"},
+	} {
+		options := []Option{WithArchiver(multiArchiver{})}
+		if tc.entry != "" {
+			options = append(options, WithArchiveEntry(tc.entry))
+		}
+		tDump, err := Wikidump{}.With(options...)
+		if err != nil {
+			t.Fatal("With returns ", err)
+		}
+		r, err := tDump.open(context.Background(), fi)
+		if tc.errContains != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.errContains) {
+				t.Error("open should fail mentioning", tc.errContains, "while it returns", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal("open returns ", err)
+		}
+		if data, err := ioutil.ReadAll(r); err != nil || string(data) != tc.content {
+			t.Error("Reading returns ", string(data), err)
+		}
+		r.Close()
+	}
+}
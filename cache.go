@@ -0,0 +1,168 @@
+package wikidump
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// cachePath returns the path of fi in the cache, or an empty string if fi can't be cached. Files whose downloads
+// are not verified, as with WithChecksumVerification disabled, are neither stored in the cache nor read from it.
+func (w Wikidump) cachePath(fi fileInfo) string {
+	if w.cacheDir == "" || fi.SHA1 == "" || !w.verifies(fi) {
+		return ""
+	}
+	return filepath.Join(w.cacheDir, fi.SHA1+"-"+path.Base(fi.URL))
+}
+
+// cached opens fi from the cache, if present.
+func (w Wikidump) cached(fi fileInfo) (virtualFile, bool) {
+	cachePath := w.cachePath(fi)
+	if cachePath == "" {
+		return virtualFile{}, false
+	}
+	f, err := os.Open(cachePath)
+	if err != nil {
+		if cachePath = w.cachedTwin(fi, cachePath); cachePath == "" {
+			return virtualFile{}, false
+		}
+		if f, err = os.Open(cachePath); err != nil {
+			return virtualFile{}, false
+		}
+	}
+	return virtualFile{f, f.Close, cachePath}, true
+}
+
+// cachedTwin looks in the cache for a file with the same SHA1 sum of fi, as when different names in the index
+// refer to identical content. The twin is hard linked to cachePath, whose path is returned; if linking fails
+// the path of the twin itself is returned. If there's no twin it returns an empty string.
+func (w Wikidump) cachedTwin(fi fileInfo, cachePath string) string {
+	twins, _ := filepath.Glob(filepath.Join(w.cacheDir, fi.SHA1+"-*"))
+	for _, twin := range twins {
+		if twin == cachePath {
+			continue
+		}
+		if err := os.Link(twin, cachePath); err != nil {
+			return twin
+		}
+		return cachePath
+	}
+	return ""
+}
+
+// RepairCache verifies the checksum of every file in the cache, downloading again the corrupt ones.
+// Files that are not in the cache are not downloaded. Sums are computed concurrently, as in VerifyMirror.
+// It fails if WithChecksumVerification is disabled.
+func (w Wikidump) RepairCache(ctx context.Context) (report Report, err error) {
+	if w.cacheDir == "" {
+		return Report{}, errors.New("Error: no cache directory")
+	}
+	if w.skipChecksums {
+		return Report{}, errors.New("Error: checksum verification is disabled")
+	}
+
+	ffi, paths := []fileInfo{}, []string{}
+	for _, fi := range w.sortedInfos() {
+		if cachePath := w.cachePath(fi); cachePath != "" {
+			ffi, paths = append(ffi, fi), append(paths, cachePath)
+		}
+	}
+
+	sums, err := w.checksums(ctx, ffi, paths)
+	if err != nil {
+		return Report{}, err
+	}
+	for i, sum := range sums {
+		cachePath := paths[i]
+		switch {
+		case os.IsNotExist(errors.Cause(sum.err)):
+			continue
+		case sum.err != nil:
+			return Report{}, sum.err
+		case sum.matches(ffi[i]):
+			report.Verified = append(report.Verified, cachePath)
+			continue
+		}
+
+		report.Corrupt = append(report.Corrupt, cachePath)
+		fi := ffi[i]
+		if err = w.stubbornly(ctx, fi.URL, func() error { return w.downloadTo(ctx, fi, cachePath) }); err != nil {
+			return report, err
+		}
+		report.Repaired = append(report.Repaired, cachePath)
+	}
+	return
+}
+
+// CacheDecompressed stores in the cache the decompressed content of all the resources associated with filename,
+// returning the path of the cached file. The content is extracted under a unique ".partial" name, that is renamed only
+// once the extraction succeeds, so an interrupted extraction never leaves a valid-looking entry in the cache
+// and concurrent extractions, even from other processes sharing the cache, don't mix. The partial files of filename
+// left by crashed extractions are removed once they're not written for stalePartialAge.
+func (w Wikidump) CacheDecompressed(ctx context.Context, filename string) (string, error) {
+	if w.cacheDir == "" {
+		return "", errors.New("Error: no cache directory")
+	}
+	if err := w.CheckFor(filename); err != nil {
+		return "", err
+	}
+
+	hash := sha1.New()
+	for _, fi := range w.file2Info[filename] {
+		io.WriteString(hash, fi.SHA1)
+	}
+	cachePath := filepath.Join(w.cacheDir, fmt.Sprintf("%x-%v", hash.Sum(nil), filename))
+	if _, err := os.Stat(cachePath); err == nil {
+		return cachePath, nil
+	}
+	w.removeStalePartials(cachePath)
+
+	f, err := ioutil.TempFile(w.cacheDir, filepath.Base(cachePath)+".*.partial") //unique, as extractions may be concurrent
+	if err != nil {
+		return "", errors.Wrap(err, "Error: unable to create temporary file in "+w.cacheDir)
+	}
+	partialPath := f.Name()
+	fail := func(e error) (string, error) {
+		f.Close()
+		os.Remove(partialPath)
+		return "", e
+	}
+
+	r := w.openAll(ctx, filename)
+	defer r.Close()
+	if _, err = io.Copy(f, r); err != nil {
+		return fail(errors.Wrap(err, "Error: unable to extract the content of "+filename))
+	}
+	if err = f.Close(); err != nil {
+		return fail(errors.Wrap(err, "Error: unable to close the following file: "+partialPath))
+	}
+	if err = os.Rename(partialPath, cachePath); err != nil {
+		return fail(errors.Wrap(err, "Error: unable to move to the cache the following file: "+partialPath))
+	}
+	return cachePath, nil
+}
+
+// stalePartialAge is the time after its last write when a partial file of CacheDecompressed is considered left by
+// a crashed extraction, as the ones in progress write it continuously.
+const stalePartialAge = time.Hour
+
+// removeStalePartials removes the stale partial files of the extractions to cachePath.
+func (w Wikidump) removeStalePartials(cachePath string) {
+	partials, _ := filepath.Glob(cachePath + ".*.partial")
+	for _, partial := range partials {
+		if info, err := os.Stat(partial); err != nil || time.Since(info.ModTime()) < stalePartialAge {
+			continue
+		}
+		if err := os.Remove(partial); err == nil {
+			w.logf("Removed the stale partial file %v", partial)
+		}
+	}
+}
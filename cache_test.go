@@ -0,0 +1,406 @@
+package wikidump
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// countingServer serves name2MyInfo, counting the requests for each path.
+func countingServer() (server *httptest.Server, requests func(path string) int) {
+	var mu sync.Mutex
+	path2Count := map[string]int{}
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		path2Count[r.URL.Path]++
+		mu.Unlock()
+		w.Write(name2MyInfo[r.URL.Path].Data)
+	}))
+	return server, func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return path2Count[path]
+	}
+}
+
+func TestRepairCache(t *testing.T) {
+	server, requests := countingServer()
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	name2fi := map[string]fileInfo{}
+	ffi := make([]fileInfo, 0, len(name2MyInfo))
+	for name, info := range name2MyInfo {
+		name2fi[name] = fileInfo{URL: server.URL + name, SHA1: info.SHA1}
+		ffi = append(ffi, name2fi[name])
+	}
+	tDump, err := Wikidump{file2Info: map[string][]fileInfo{"helloword": ffi}}.With(WithCache(cacheDir))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+
+	//helloword.gz is valid, helloword.bz2 is corrupted and helloword.7z is not cached
+	gzPath, bz2Path := tDump.cachePath(name2fi["/helloword.gz"]), tDump.cachePath(name2fi["/helloword.bz2"])
+	if err := ioutil.WriteFile(gzPath, name2MyInfo["/helloword.gz"].Data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(bz2Path, []byte("corrupted"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := tDump.RepairCache(context.Background())
+	if err != nil {
+		t.Fatal("RepairCache returns ", err)
+	}
+	expected := Report{Verified: []string{gzPath}, Corrupt: []string{bz2Path}, Repaired: []string{bz2Path}}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("Report should be %+v but it's %+v", expected, report)
+	}
+	for name, count := range map[string]int{"/helloword.gz": 0, "/helloword.bz2": 1, "/helloword.7z": 0} {
+		if requests(name) != count {
+			t.Error(name, "should be requested", count, "times, while it's requested", requests(name), "times")
+		}
+	}
+	if sha1, err := fileSHA1(bz2Path); err != nil || sha1 != name2MyInfo["/helloword.bz2"].SHA1 {
+		t.Error("The corrupt file is not repaired: ", err)
+	}
+
+	//cached files are not downloaded again and survive Close
+	for i := 0; i < 2; i++ {
+		r, err := tDump.open(context.Background(), name2fi["/helloword.7z"])
+		if err != nil {
+			t.Fatal("open returns ", err)
+		}
+		if data, err := ioutil.ReadAll(r); err != nil || string(data) != helloword {
+			t.Error("Reading returns ", string(data), err)
+		}
+		if err := r.Close(); err != nil {
+			t.Error("Closing returns ", err)
+		}
+	}
+	if requests("/helloword.7z") != 1 {
+		t.Error("/helloword.7z should be requested once, while it's requested", requests("/helloword.7z"), "times")
+	}
+}
+
+func TestOpenCaches(t *testing.T) {
+	server, requests := countingServer()
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	info := name2MyInfo["/helloword.gz"]
+	fi, corrupt := fileInfo{URL: server.URL + "/helloword.gz", SHA1: info.SHA1}, fileInfo{URL: server.URL + "/helloword.7z", SHA1: name2MyInfo["/helloword.bz2"].SHA1}
+	tDump, err := Wikidump{file2Info: map[string][]fileInfo{"helloword": {fi}, "corrupt": {corrupt}}}.With(
+		WithCache(cacheDir), WithShouldRetry(func(error, int) bool { return false }))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+
+	r, err := tDump.Open("helloword")(context.Background())
+	if err != nil {
+		t.Fatal("Open returns ", err)
+	}
+	if data, err := ioutil.ReadAll(r); err != nil || string(data) != helloword {
+		t.Error("Reading returns ", string(data), err)
+	}
+	r.Close()
+	if data, err := ioutil.ReadFile(tDump.cachePath(fi)); err != nil || !bytes.Equal(data, info.Data) {
+		t.Error("The cache should store the compressed file, while reading it returns ", err)
+	}
+	if requests("/helloword.gz") != 1 {
+		t.Error("The file should be downloaded once, while it's downloaded", requests("/helloword.gz"), "times")
+	}
+
+	//files failing verification don't enter the cache
+	if _, err := tDump.Open("corrupt")(context.Background()); err == nil {
+		t.Error("Opening a file with a mismatched SHA1 should fail")
+	}
+	if _, err := os.Stat(tDump.cachePath(corrupt)); !os.IsNotExist(err) {
+		t.Error("A file failing verification should not be cached, while Stat returns ", err)
+	}
+}
+
+func TestCacheUnverified(t *testing.T) {
+	server, _ := countingServer()
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	//the body doesn't match the SHA1 sum, as a recompressed variant
+	fi := fileInfo{URL: server.URL + "/helloword.gz", SHA1: name2MyInfo["/helloword.bz2"].SHA1}
+	unverified, err := Wikidump{file2Info: map[string][]fileInfo{"helloword": {fi}}}.With(
+		WithCache(cacheDir), WithChecksumVerification(false))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	r, err := unverified.Open("helloword")(context.Background())
+	if err != nil {
+		t.Fatal("Open returns ", err)
+	}
+	r.Close()
+	if entries, _ := ioutil.ReadDir(cacheDir); len(entries) > 0 {
+		t.Error("Unverified downloads should not enter the cache, while it holds ", len(entries), " files")
+	}
+
+	verified, err := unverified.With(WithChecksumVerification(true), WithShouldRetry(func(error, int) bool { return false }))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	if _, err := verified.Open("helloword")(context.Background()); !errors.Is(err, ErrChecksumMismatch) {
+		t.Error("Open should return ErrChecksumMismatch, while it returns ", err)
+	}
+	if _, err := unverified.RepairCache(context.Background()); err == nil {
+		t.Error("RepairCache should fail without checksum verification")
+	}
+}
+
+func TestCacheTwins(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.Write(name2MyInfo["/helloword.gz"].Data)
+	}))
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	//two names in the index share the same SHA1
+	sha1 := name2MyInfo["/helloword.gz"].SHA1
+	tDump, err := Wikidump{file2Info: map[string][]fileInfo{
+		"one": {{URL: server.URL + "/one.gz", SHA1: sha1}},
+		"two": {{URL: server.URL + "/two.gz", SHA1: sha1}},
+	}}.With(WithCache(cacheDir))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+
+	for _, name := range []string{"one", "two", "two"} {
+		r, err := tDump.Open(name)(context.Background())
+		if err != nil {
+			t.Fatal("Open returns ", err)
+		}
+		if data, err := ioutil.ReadAll(r); err != nil || string(data) != helloword {
+			t.Error("Reading ", name, " returns ", string(data), err)
+		}
+		r.Close()
+	}
+	if requests != 1 {
+		t.Error("Identical files should be downloaded once, while they're downloaded", requests, "times")
+	}
+}
+
+func TestCacheDecompressed(t *testing.T) {
+	server, _ := countingServer()
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	//the second part of broken is corrupted, so the extraction is interrupted after the first one
+	gz := fileInfo{URL: server.URL + "/helloword.gz", SHA1: name2MyInfo["/helloword.gz"].SHA1}
+	tDump, err := Wikidump{file2Info: map[string][]fileInfo{
+		"helloword": {gz, gz},
+		"broken":    {gz, {URL: server.URL + "/helloword.bz2", SHA1: "corrupted"}},
+	}}.With(WithCache(cacheDir), WithShouldRetry(func(err error, attempt int) bool { return false }))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if cachePath, err := tDump.CacheDecompressed(context.Background(), "broken"); err == nil {
+			t.Error("CacheDecompressed should fail, while it returns ", cachePath)
+		}
+	}
+	if entries, _ := filepath.Glob(filepath.Join(cacheDir, "*broken*")); len(entries) > 0 {
+		t.Error("Interrupted extractions should leave no entry in the cache, while they leave ", entries)
+	}
+
+	//concurrent extractions don't mix
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cachePath, err := tDump.CacheDecompressed(context.Background(), "helloword")
+			if err != nil {
+				t.Error("CacheDecompressed returns ", err)
+				return
+			}
+			if data, err := ioutil.ReadFile(cachePath); err != nil || string(data) != helloword+helloword {
+				t.Error("The cached file contains ", string(data), err)
+			}
+			if strings.HasSuffix(cachePath, ".partial") {
+				t.Error("A partial file is served as complete: ", cachePath)
+			}
+		}()
+	}
+	wg.Wait()
+	if entries, _ := filepath.Glob(filepath.Join(cacheDir, "*.partial")); len(entries) > 0 {
+		t.Error("Extractions should leave no partial file, while they leave ", entries)
+	}
+
+	//the partial files left by crashed extractions are removed, unless they may be in progress
+	for i, age := range []time.Duration{0, 2 * stalePartialAge} {
+		partial := filepath.Join(cacheDir, fmt.Sprintf("0000-broken.%v.partial", i))
+		if err := ioutil.WriteFile(partial, []byte(helloword), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := time.Now().Add(-age)
+		if err := os.Chtimes(partial, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tDump.removeStalePartials(filepath.Join(cacheDir, "0000-broken"))
+	if entries, _ := filepath.Glob(filepath.Join(cacheDir, "*.partial")); len(entries) != 1 || !strings.HasSuffix(entries[0], ".0.partial") {
+		t.Error("Only the stale partial file should be removed, while the partial files left are ", entries)
+	}
+}
+
+func TestCacheAcrossFilesystems(t *testing.T) {
+	server, _ := countingServer()
+	defer server.Close()
+
+	tmpDir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	cacheDir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	//renames across directories fail as across filesystems
+	sha1 := name2MyInfo["/helloword.gz"].SHA1
+	defer func(old func(string, string) error) { rename = old }(rename)
+	rename = func(src, dst string) error {
+		if filepath.Dir(src) != filepath.Dir(dst) {
+			return &os.LinkError{Op: "rename", Old: src, New: dst, Err: syscall.EXDEV}
+		}
+		if matched, _ := filepath.Match(sha1+"-*", filepath.Base(src)); matched {
+			t.Error("The partial copy in the cache looks like a cached file: ", src)
+		}
+		return os.Rename(src, dst)
+	}
+
+	tDump, err := Wikidump{tmpDir: tmpDir}.With(WithCache(cacheDir))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	fi := fileInfo{URL: server.URL + "/helloword.gz", SHA1: sha1}
+	r, err := tDump.open(context.Background(), fi)
+	if err != nil {
+		t.Fatal("open returns ", err)
+	}
+	if data, err := ioutil.ReadAll(r); err != nil || string(data) != helloword {
+		t.Error("Reading returns ", string(data), err)
+	}
+	r.Close()
+
+	if sum, err := fileSHA1(tDump.cachePath(fi)); err != nil || sum != fi.SHA1 {
+		t.Error("The file is not moved to the cache: ", err)
+	}
+	if leftovers, _ := ioutil.ReadDir(tmpDir); len(leftovers) > 0 {
+		t.Error("The temporary directory should be empty, while it contains ", len(leftovers), " files")
+	}
+}
+
+func TestRevalidation(t *testing.T) {
+	var mu sync.Mutex
+	etag, status2Count := `"v1"`, map[int]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("If-None-Match") == etag {
+			status2Count[http.StatusNotModified]++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		status2Count[http.StatusOK]++
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(etag))
+	}))
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+	tDump, err := Wikidump{}.With(WithCache(cacheDir))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	fi := fileInfo{URL: server.URL + "/site_stats.txt"}
+	read := func() string {
+		r, err := tDump.open(context.Background(), fi)
+		if err != nil {
+			t.Fatal("open returns ", err)
+		}
+		defer r.Close()
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal("Reading returns ", err)
+		}
+		return string(data)
+	}
+
+	if data := read(); data != `"v1"` {
+		t.Error("The first read returns ", data)
+	}
+	if data := read(); data != `"v1"` || status2Count[http.StatusNotModified] != 1 || status2Count[http.StatusOK] != 1 {
+		t.Error("The second read should be served from the cache, while it returns", data, status2Count)
+	}
+	mu.Lock()
+	etag = `"v2"`
+	mu.Unlock()
+	if data := read(); data != `"v2"` || status2Count[http.StatusOK] != 2 {
+		t.Error("A modified file should be downloaded again, while it returns", data, status2Count)
+	}
+
+	//files with a sum are verified rather than revalidated
+	fi = fileInfo{URL: server.URL + "/site_stats.txt", MD5: "d41d8cd98f00b204e9800998ecf8427e"}
+	if tDump, err = tDump.With(WithShouldRetry(func(error, int) bool { return false })); err != nil {
+		t.Fatal("With returns ", err)
+	}
+	if _, err := tDump.open(context.Background(), fi); !errors.Is(err, ErrChecksumMismatch) {
+		t.Error("open should return ErrChecksumMismatch, while it returns ", err)
+	}
+}
@@ -0,0 +1,137 @@
+package wikidump
+
+import (
+	"bufio"
+	"crypto"
+	_ "crypto/md5"    //registers crypto.MD5
+	_ "crypto/sha1"   //registers crypto.SHA1
+	_ "crypto/sha256" //registers crypto.SHA256
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrChecksumMismatch is returned, wrapped, when a download doesn't match its SHA256, SHA1 or MD5 sum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// checksum returns the name and the hash of the algorithm verifying fi along with the expected sum in hex,
+// choosing the strongest known: SHA256, then SHA1, then MD5.
+func (fi fileInfo) checksum() (name string, hash crypto.Hash, sum string) {
+	switch {
+	case fi.SHA256 != "":
+		return "SHA256", crypto.SHA256, fi.SHA256
+	case fi.SHA1 == "" && fi.MD5 != "":
+		return "MD5", crypto.MD5, fi.MD5
+	}
+	return "SHA1", crypto.SHA1, fi.SHA1
+}
+
+// hasChecksum reports whether the index has a sum verifying fi.
+func (fi fileInfo) hasChecksum() bool {
+	_, _, sum := fi.checksum()
+	return sum != ""
+}
+
+// WithChecksumVerification sets whether downloads are verified against their checksum, as by default.
+// Disabling it is unsafe: corrupt, truncated or tampered files are accepted as they are, and no retry fixes them.
+// It's meant only for mirrors serving files whose sums differ from the index, such as recompressed variants.
+// Resources without a sum in the index are never verified.
+func WithChecksumVerification(enabled bool) Option {
+	return func(w *Wikidump) error {
+		w.skipChecksums = !enabled
+		return nil
+	}
+}
+
+// verifies reports whether the downloads of fi are verified.
+func (w Wikidump) verifies(fi fileInfo) bool {
+	return !w.skipChecksums && fi.hasChecksum()
+}
+
+// verifyStored checks that the file at filename storing fi matches its checksum, if downloads of fi are verified.
+func (w Wikidump) verifyStored(filename string, fi fileInfo) error {
+	if !w.verifies(fi) {
+		return nil
+	}
+	return verifyFile(filename, fi)
+}
+
+// verifyFile checks that the file at filename matches the checksum of fi.
+func verifyFile(filename string, fi fileInfo) error {
+	name, hash, expected := fi.checksum()
+	sum, err := fileSum(filename, hash)
+	if err != nil {
+		return err
+	}
+	if sum != expected {
+		return errors.Wrap(ErrChecksumMismatch, "Error: mismatched "+name+" for the file downloaded from the following url: "+fi.URL)
+	}
+	return nil
+}
+
+// fileSum returns the sum in hex of the file at filename computed with hash.
+func fileSum(filename string, hash crypto.Hash) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", errors.Wrap(err, "Error: unable to open the following file: "+filename)
+	}
+	defer f.Close()
+
+	h := hash.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", errors.Wrap(err, "Error: unable to read the following file: "+filename)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// WithSHA256Sums adds to the files of the wikidump the SHA256 sums listed in sums, in the format of the sha256sums.txt
+// published alongside each dump: one sum in hex and one file name per line, separated by white space.
+// Files with a SHA256 sum are verified with it instead of their SHA1 sum, sums of files not in the wikidump are ignored.
+func WithSHA256Sums(sums io.Reader) Option {
+	return withSums(sums, "SHA256", crypto.SHA256, func(fi *fileInfo, sum string) { fi.SHA256 = sum })
+}
+
+// WithMD5Sums adds to the files of the wikidump the MD5 sums listed in sums, in the format of the md5sums.txt
+// published alongside older and mirrored dumps. Files are verified with their MD5 sum only if there's no SHA256 or SHA1 sum,
+// sums of files not in the wikidump are ignored.
+func WithMD5Sums(sums io.Reader) Option {
+	return withSums(sums, "MD5", crypto.MD5, func(fi *fileInfo, sum string) { fi.MD5 = sum })
+}
+
+// withSums adds to the files of the wikidump the sums computed with hash listed in sums, setting them with set.
+func withSums(sums io.Reader, name string, hash crypto.Hash, set func(fi *fileInfo, sum string)) Option {
+	return func(w *Wikidump) error {
+		name2Sum := map[string]string{}
+		scanner := bufio.NewScanner(sums)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 0 {
+				continue
+			}
+			if len(fields) != 2 || len(fields[0]) != 2*hash.Size() {
+				return errors.Errorf("Error: invalid line in the %v sums: %q", name, scanner.Text())
+			}
+			name2Sum[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+		}
+		if err := scanner.Err(); err != nil {
+			return errors.Wrap(err, "Error: unable to read the "+name+" sums")
+		}
+
+		file2Info := make(map[string][]fileInfo, len(w.file2Info))
+		for file, ffi := range w.file2Info {
+			file2Info[file] = make([]fileInfo, len(ffi))
+			for i, fi := range ffi {
+				if sum, ok := name2Sum[path.Base(fi.URL)]; ok {
+					set(&fi, sum)
+				}
+				file2Info[file][i] = fi
+			}
+		}
+		w.file2Info = file2Info
+		return nil
+	}
+}
@@ -0,0 +1,232 @@
+package wikidump
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/md5"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fileSHA1 returns the SHA1 sum in hex of the file at filename.
+func fileSHA1(filename string) (string, error) {
+	return fileSum(filename, crypto.SHA1)
+}
+
+func TestSHA256(t *testing.T) {
+	server, _ := countingServer()
+	defer server.Close()
+
+	info := name2MyInfo["/helloword.gz"]
+	sum := fmt.Sprintf("%x", sha256.Sum256(info.Data))
+	url := server.URL + "/helloword.gz"
+	tDump, err := Wikidump{file2Info: map[string][]fileInfo{"helloword": {{URL: url, SHA1: info.SHA1}}}}.With(
+		WithSHA256Sums(strings.NewReader("\n"+sum+"  helloword.gz\n"+strings.Repeat("0", 64)+" *other.gz\n")),
+		WithShouldRetry(func(error, int) bool { return false }))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	if fi := tDump.file2Info["helloword"][0]; fi.SHA256 != sum {
+		t.Error("WithSHA256Sums should set the SHA256 sum, while it's ", fi.SHA256)
+	}
+
+	//SHA256 is preferred to SHA1
+	for _, tc := range []struct {
+		fi    fileInfo
+		valid bool
+	}{
+		{fileInfo{URL: url, SHA1: "wrong", SHA256: sum}, true},
+		{fileInfo{URL: url, SHA1: info.SHA1, SHA256: strings.Repeat("0", 64)}, false},
+		{fileInfo{URL: url, SHA1: info.SHA1}, true},
+	} {
+		r, err := tDump.open(context.Background(), tc.fi)
+		switch {
+		case tc.valid && err != nil:
+			t.Error("open returns ", err)
+		case !tc.valid && (!errors.Is(err, ErrChecksumMismatch) || !strings.Contains(err.Error(), "mismatched SHA256")):
+			t.Error("open should fail verifying the SHA256 sum, while it returns ", err)
+		case tc.valid:
+			r.Close()
+		}
+	}
+
+	if _, err := tDump.With(WithSHA256Sums(strings.NewReader("notasum helloword.gz\n"))); err == nil {
+		t.Error("Invalid SHA256 sums should be rejected")
+	}
+}
+
+func TestMD5(t *testing.T) {
+	server, _ := countingServer()
+	defer server.Close()
+
+	info := name2MyInfo["/helloword.gz"]
+	sum := fmt.Sprintf("%x", md5.Sum(info.Data))
+	url := server.URL + "/helloword.gz"
+	tDump, err := Wikidump{file2Info: map[string][]fileInfo{"helloword": {{URL: url}}}}.With(
+		WithMD5Sums(strings.NewReader(sum+"  helloword.gz\n")),
+		WithShouldRetry(func(error, int) bool { return false }))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	if fi := tDump.file2Info["helloword"][0]; fi.MD5 != sum {
+		t.Error("WithMD5Sums should set the MD5 sum, while it's ", fi.MD5)
+	}
+
+	//MD5 is used only without SHA1
+	for _, tc := range []struct {
+		fi    fileInfo
+		valid bool
+	}{
+		{fileInfo{URL: url, MD5: sum}, true},
+		{fileInfo{URL: url, MD5: strings.Repeat("0", 32)}, false},
+		{fileInfo{URL: url, SHA1: info.SHA1, MD5: strings.Repeat("0", 32)}, true},
+	} {
+		r, err := tDump.open(context.Background(), tc.fi)
+		switch {
+		case tc.valid && err != nil:
+			t.Error("open returns ", err)
+		case !tc.valid && (!errors.Is(err, ErrChecksumMismatch) || !strings.Contains(err.Error(), "mismatched MD5")):
+			t.Error("open should fail verifying the MD5 sum, while it returns ", err)
+		case tc.valid:
+			r.Close()
+		}
+	}
+
+	if _, err := tDump.With(WithMD5Sums(strings.NewReader(strings.Repeat("0", 64) + " helloword.gz\n"))); err == nil {
+		t.Error("Sums of another length should be rejected")
+	}
+}
+
+func TestVerifyOnDisk(t *testing.T) {
+	server, _ := countingServer()
+	defer server.Close()
+
+	tDump, err := Wikidump{}.With(WithVerifyOnDisk(true))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	info := name2MyInfo["/helloword.gz"]
+	r, err := tDump.open(context.Background(), fileInfo{URL: server.URL + "/helloword.gz", SHA1: info.SHA1})
+	if err != nil {
+		t.Fatal("open returns ", err)
+	}
+	if data, err := ioutil.ReadAll(r); err != nil || string(data) != helloword {
+		t.Error("Reading returns ", string(data), err)
+	}
+	r.Close()
+
+	//corrupted cached files are reported with an error
+	cacheDir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+	fi := fileInfo{URL: server.URL + "/helloword.gz", SHA1: info.SHA1}
+	tDump, err = Wikidump{file2Info: map[string][]fileInfo{"helloword": {fi}}}.With(
+		WithCache(cacheDir), WithVerifyOnDisk(true))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	data := append([]byte{}, info.Data...)
+	data[len(data)/2] ^= 1
+	if err := ioutil.WriteFile(tDump.cachePath(fi), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tDump.Open("helloword")(context.Background()); !errors.Is(err, ErrChecksumMismatch) {
+		t.Error("Open should report the mismatch of the cached file, while it returns ", err)
+	}
+}
+
+func TestVerifyOnDiskResumed(t *testing.T) {
+	info := name2MyInfo["/helloword.bz2"]
+	half := len(info.Data) / 2
+	tmpDir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			//the first attempt breaks after half the file
+			w.Header().Set("Content-Length", strconv.Itoa(len(info.Data)))
+			w.Write(info.Data[:half])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		//the partial download gets corrupted before being resumed
+		if files, _ := ioutil.ReadDir(tmpDir); len(files) == 1 {
+			name := filepath.Join(tmpDir, files[0].Name())
+			if data, err := ioutil.ReadFile(name); err == nil && len(data) > 0 {
+				data[0] ^= 1
+				ioutil.WriteFile(name, data, 0644)
+			}
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(info.Data))
+	}))
+	defer server.Close()
+
+	fi := fileInfo{URL: server.URL + "/helloword.bz2", SHA1: info.SHA1}
+	tDump, err := Wikidump{tmpDir: tmpDir, file2Info: map[string][]fileInfo{"helloword": {fi}}}.With(
+		WithVerifyOnDisk(true),
+		WithShouldRetry(func(err error, attempt int) bool { return !errors.Is(err, ErrChecksumMismatch) }))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	if _, err := tDump.Open("helloword")(context.Background()); !errors.Is(err, ErrChecksumMismatch) {
+		t.Error("Open should report the mismatch of the resumed file, while it returns ", err)
+	}
+	if attempts != 2 {
+		t.Error("The download should be resumed once, while it's attempted", attempts, "times")
+	}
+}
+
+func TestChecksumVerification(t *testing.T) {
+	server, _ := countingServer()
+	defer server.Close()
+
+	url := server.URL + "/helloword.gz"
+	unverified, err := Wikidump{}.With(WithChecksumVerification(false))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	verified, err := unverified.With(WithChecksumVerification(true), WithShouldRetry(func(error, int) bool { return false }))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	for _, tc := range []struct {
+		w     Wikidump
+		fi    fileInfo
+		valid bool
+	}{
+		{unverified, fileInfo{URL: url, SHA1: "wrong"}, true},
+		{verified, fileInfo{URL: url}, true},
+		{verified, fileInfo{URL: url, SHA1: "wrong"}, false},
+	} {
+		r, err := tc.w.open(context.Background(), tc.fi)
+		if tc.valid != (err == nil) {
+			t.Error("open of", tc.fi, "should be valid:", tc.valid, "while it returns", err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if data, err := ioutil.ReadAll(r); err != nil || string(data) != helloword {
+			t.Error("Reading returns ", string(data), err)
+		}
+		r.Close()
+	}
+}
@@ -0,0 +1,76 @@
+package wikidump
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// ChunkPages splits the decompressed XML of filename in chunks of up to pagesPerChunk pages, passing to emit
+// each chunk as a standalone gzip file along with its index. Chunks contain only the <page> elements, in order,
+// the header with the site info and the closing tag are left out. Processing stops at the first error of emit.
+func (w Wikidump) ChunkPages(ctx context.Context, filename string, pagesPerChunk int, emit func(i int, chunk []byte) error) error {
+	if err := w.CheckFor(filename); err != nil {
+		return err
+	}
+	r := w.openAll(ctx, filename)
+	defer r.Close()
+	return chunkPages(r, pagesPerChunk, emit)
+}
+
+func chunkPages(r io.Reader, pagesPerChunk int, emit func(i int, chunk []byte) error) error {
+	if pagesPerChunk <= 0 {
+		return errors.Errorf("Error: invalid number of pages per chunk %v", pagesPerChunk)
+	}
+
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	chunks, pages, inPage := 0, 0, false
+	flush := func() error {
+		if err := gz.Close(); err != nil {
+			return errors.Wrap(err, "Error: unable to compress a chunk")
+		}
+		chunk := append([]byte{}, buffer.Bytes()...)
+		buffer.Reset()
+		gz.Reset(&buffer)
+		chunks, pages = chunks+1, 0
+		return emit(chunks-1, chunk)
+	}
+
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		trimmed := bytes.TrimSpace(line)
+		if bytes.HasPrefix(trimmed, []byte("<page>")) {
+			inPage = true
+		}
+		if inPage {
+			if _, err := gz.Write(line); err != nil {
+				return errors.Wrap(err, "Error: unable to compress a chunk")
+			}
+		}
+		if inPage && bytes.HasSuffix(trimmed, []byte("</page>")) {
+			inPage = false
+			if pages++; pages == pagesPerChunk {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+
+		switch {
+		case err == io.EOF && inPage:
+			return errors.New("Error: unterminated page in the XML")
+		case err == io.EOF && pages > 0:
+			return flush()
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return errors.Wrap(err, "Error: unable to read the XML")
+		}
+	}
+}
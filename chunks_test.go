@@ -0,0 +1,49 @@
+package wikidump
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestChunkPages(t *testing.T) {
+	var pages []string
+	for i := 0; i < 7; i++ {
+		pages = append(pages, fmt.Sprintf("  <page>\n    <title>Page %v</title>\n  </page>\n", i))
+	}
+	xml := "<mediawiki>\n  <siteinfo>\n  </siteinfo>\n" + strings.Join(pages, "") + "</mediawiki>\n"
+
+	var chunks []string
+	err := chunkPages(strings.NewReader(xml), 3, func(i int, chunk []byte) error {
+		if i != len(chunks) {
+			t.Error("Chunk", i, "emitted out of order")
+		}
+		r, err := gzip.NewReader(bytes.NewReader(chunk))
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadAll(r)
+		chunks = append(chunks, string(data))
+		return err
+	})
+	if err != nil {
+		t.Fatal("chunkPages returns ", err)
+	}
+
+	expected := []string{strings.Join(pages[:3], ""), strings.Join(pages[3:6], ""), pages[6]}
+	if len(chunks) != len(expected) {
+		t.Fatal("chunkPages should emit", len(expected), "chunks, while it emits", len(chunks))
+	}
+	for i := range expected {
+		if chunks[i] != expected[i] {
+			t.Errorf("Chunk %v should be %q but it's %q", i, expected[i], chunks[i])
+		}
+	}
+
+	if err := chunkPages(strings.NewReader("<page>\n"), 3, func(int, []byte) error { return nil }); err == nil {
+		t.Error("Error should be not null")
+	}
+}
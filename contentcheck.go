@@ -0,0 +1,66 @@
+package wikidump
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnexpectedContent is returned when the beginning of a decompressed file doesn't match its kind and the content check is enabled.
+var ErrUnexpectedContent = errors.New("unexpected content")
+
+// WithContentCheck sets whether the first bytes of every decompressed file are validated against the kind
+// stated by its name: XML dumps must start with an XML declaration or a mediawiki element, SQL dumps with
+// "-- MySQL dump" or "CREATE TABLE" and JSON dumps with an array or an object. Opening a file whose content
+// doesn't match fails early with ErrUnexpectedContent, catching wrong files served in place of the expected ones.
+// Files of other kinds aren't checked. By default it's disabled.
+func WithContentCheck(enabled bool) Option {
+	return func(w *Wikidump) error {
+		w.contentCheck = enabled
+		return nil
+	}
+}
+
+// kind2Prefixes maps file kinds to the prefixes allowed for their content, after leading white space.
+var kind2Prefixes = map[string][]string{
+	"xml":  {"<?xml", "<mediawiki"},
+	"sql":  {"-- MySQL dump", "CREATE TABLE"},
+	"json": {"[", "{"},
+}
+
+// maxContentPeek is the number of bytes inspected by the content check.
+const maxContentPeek = 512
+
+// kindOf returns the kind of the content of the file at url, as in kind2Prefixes, or "" if unknown.
+func kindOf(url string) string {
+	for _, ext := range strings.Split(path.Base(url), ".")[1:] {
+		if _, ok := kind2Prefixes[ext]; ok {
+			return ext
+		}
+	}
+	return ""
+}
+
+// checkContent checks that the beginning of r matches the kind of fi, closing r on failure.
+func checkContent(r virtualFile, fi fileInfo) (virtualFile, error) {
+	kind := kindOf(fi.URL)
+	if kind == "" {
+		return r, nil
+	}
+
+	br := bufio.NewReaderSize(r.Reader, maxContentPeek)
+	r.Reader = br
+	head, _ := br.Peek(maxContentPeek)
+	head = bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n")
+	for _, prefix := range kind2Prefixes[kind] {
+		if bytes.HasPrefix(head, []byte(prefix)) {
+			return r, nil
+		}
+	}
+
+	r.Close()
+	return virtualFile{}, errors.Wrapf(ErrUnexpectedContent, "no %v content in the file downloaded from the following url: %v", kind, fi.URL)
+}
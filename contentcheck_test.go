@@ -0,0 +1,57 @@
+package wikidump
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContentCheck(t *testing.T) {
+	name2Info := map[string]myInfo{
+		"/pages.xml.gz":     gzipMyInfo("<mediawiki xmlns=\"http://www.mediawiki.org/xml/export-0.10/\">"),
+		"/wrong.xml.gz":     gzipMyInfo("<html><body>Not found</body></html>"),
+		"/page.sql.gz":      gzipMyInfo("-- MySQL dump 10.19  Distrib 10.3.38-MariaDB"),
+		"/table.sql.gz":     gzipMyInfo("\nCREATE TABLE `page` ("),
+		"/wrong.sql.gz":     gzipMyInfo("<mediawiki>"),
+		"/entities.json.gz": gzipMyInfo("[\n{\"type\":\"item\"}"),
+		"/entity.json.gz":   gzipMyInfo("{\"type\":\"item\"}"),
+		"/wrong.json.gz":    gzipMyInfo("-- MySQL dump"),
+		"/unknown.txt.gz":   gzipMyInfo("anything"),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(name2Info[r.URL.Path].Data)
+	}))
+	defer server.Close()
+
+	tDump, err := Wikidump{}.With(WithContentCheck(true))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	for name, info := range name2Info {
+		r, err := tDump.open(context.Background(), fileInfo{URL: server.URL + name, SHA1: info.SHA1})
+		switch wrong := strings.HasPrefix(name, "/wrong"); {
+		case wrong && !errors.Is(err, ErrUnexpectedContent):
+			t.Error("Opening", name, "should return ErrUnexpectedContent, while it returns", err)
+		case !wrong && err != nil:
+			t.Error("Opening", name, "returns", err)
+		case !wrong:
+			if _, err := ioutil.ReadAll(r); err != nil {
+				t.Error("Reading", name, "returns", err)
+			}
+			r.Close()
+		}
+	}
+
+	if tDump, err = tDump.With(WithContentCheck(false)); err != nil {
+		t.Fatal("With returns ", err)
+	}
+	r, err := tDump.open(context.Background(), fileInfo{URL: server.URL + "/wrong.json.gz", SHA1: name2Info["/wrong.json.gz"].SHA1})
+	if err != nil {
+		t.Fatal("Opening /wrong.json.gz without the content check returns ", err)
+	}
+	r.Close()
+}
@@ -0,0 +1,84 @@
+package wikidump
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Decompressor returns a reader of the decompressed content of r, closing the returned reader must close r too.
+type Decompressor func(r io.ReadCloser) (io.ReadCloser, error)
+
+// decompressor is a decompressor of the registry along with the name of its format.
+type decompressor struct {
+	format     string
+	decompress func(ctx context.Context, w Wikidump, r virtualFile) (virtualFile, error)
+}
+
+// registry holds the decompressors by extension, starting from the built-in ones.
+var registry = struct {
+	sync.RWMutex
+	ext2Decompressor map[string]decompressor
+}{ext2Decompressor: map[string]decompressor{
+	".7z": {"7z", func(ctx context.Context, w Wikidump, r virtualFile) (virtualFile, error) {
+		return un7Zip(ctx, r, w.archiver, w.archiveEntry)
+	}},
+	".bz2":  {"bzip2", plain(unBZip2)},
+	".gz":   {"gzip", plain(unGZip)},
+	".lz4":  {"lz4", plain(unLz4)},
+	".zst":  {"zstd", plain(unZstd)},
+	".xz":   {"xz", plain(unXz)},
+	".lzma": {"lzma", plain(unLzma)},
+}}
+
+// plain adapts a decompressor that needs neither the context nor the wikidump.
+func plain(decompress func(virtualFile) (virtualFile, error)) func(context.Context, Wikidump, virtualFile) (virtualFile, error) {
+	return func(_ context.Context, _ Wikidump, r virtualFile) (virtualFile, error) {
+		return decompress(r)
+	}
+}
+
+// RegisterDecompressor makes decompressor handle the files whose name ends with ext, such as ".br", taking the place
+// of the built-in decompressor of ext, if any. The format of these files is named after ext without the leading dot, as in Formats;
+// if decompressor fails, r is closed. It's safe for concurrent use, but usually called from an init function.
+// It panics if ext doesn't start with a dot or decompressor is nil.
+func RegisterDecompressor(ext string, decompressor Decompressor) {
+	if len(ext) < 2 || ext[0] != '.' || decompressor == nil {
+		panic("wikidump: invalid registration of decompressor for " + ext)
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	registry.ext2Decompressor[ext] = adapt(ext[1:], decompressor)
+}
+
+// adapt adapts a registered decompressor of format to virtual files.
+func adapt(format string, d Decompressor) decompressor {
+	return decompressor{format, plain(func(ri virtualFile) (virtualFile, error) {
+		ro, err := d(ri)
+		if err != nil {
+			ri.Close()
+			return virtualFile{}, err
+		}
+		return virtualFile{ro, ro.Close, ri.Name()}, nil
+	})}
+}
+
+// lookup returns the decompressor of the longest registered extension of filename, if any.
+func lookup(filename string) (d decompressor, ok bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	ext := ""
+	for e, ed := range registry.ext2Decompressor {
+		if strings.HasSuffix(filename, e) && len(e) > len(ext) {
+			ext, d, ok = e, ed, true
+		}
+	}
+	return
+}
+
+// formatOf returns the compression format of a file according to its extension, "" if it has none.
+func formatOf(filename string) string {
+	d, _ := lookup(filename)
+	return d.format
+}
@@ -0,0 +1,89 @@
+package wikidump
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// reversed stores the reversed content of a file.
+type reversed struct {
+	io.Reader
+	io.Closer
+}
+
+func reverse(s string) string {
+	b := []byte(s)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return string(b)
+}
+
+func TestRegisterDecompressor(t *testing.T) {
+	RegisterDecompressor(".rev", func(r io.ReadCloser) (io.ReadCloser, error) {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return reversed{strings.NewReader(reverse(string(data))), r}, nil
+	})
+	defer func() {
+		registry.Lock()
+		delete(registry.ext2Decompressor, ".rev")
+		registry.Unlock()
+	}()
+	data := []byte(reverse(helloword))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	fi := fileInfo{URL: server.URL + "/helloword.txt.rev", SHA1: fmt.Sprintf("%x", sha1.Sum(data))}
+	tDump := Wikidump{file2Info: map[string][]fileInfo{"helloword": {fi}}}
+	r, err := tDump.open(context.Background(), fi)
+	if err != nil {
+		t.Fatal("open returns ", err)
+	}
+	if data, err := ioutil.ReadAll(r); err != nil || string(data) != helloword {
+		t.Error("Reading returns ", string(data), err)
+	}
+	if err := r.Close(); err != nil {
+		t.Error("Closing returns ", err)
+	}
+	if formats := tDump.Formats(); formats["rev"] != 1 {
+		t.Error("Formats should report the registered format, while it reports ", formats)
+	}
+
+	for _, ext := range []string{"", "rev", "."} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("Registering", ext, "should panic")
+				}
+			}()
+			RegisterDecompressor(ext, func(r io.ReadCloser) (io.ReadCloser, error) { return r, nil })
+		}()
+	}
+}
+
+func TestLookup(t *testing.T) {
+	RegisterDecompressor(".rev.gz", func(r io.ReadCloser) (io.ReadCloser, error) { return r, nil })
+	defer func() {
+		registry.Lock()
+		delete(registry.ext2Decompressor, ".rev.gz")
+		registry.Unlock()
+	}()
+	for filename, expected := range map[string]string{"pages.xml.bz2": "bzip2", "pages.7z": "7z", "table.sql.gz": "gzip",
+		"helloword.rev.gz": "rev.gz", "helloword.txt": ""} {
+		if format := formatOf(filename); format != expected {
+			t.Errorf("The format of %v should be %q, while it's %q", filename, expected, format)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package wikidump
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// DownloadAll stores in dir the resources associated with filenames, as they are published and without decompressing them.
+// Each resource is saved under its original name and its checksum is verified, the strongest known among SHA256, SHA1 and MD5. Resources already
+// present in dir whose checksum matches the expected one are skipped, so an interrupted DownloadAll can be resumed by calling it again.
+// If some filenames are missing from the wikidump, nothing is downloaded. See ResumeToken to resume it from another process.
+func (w Wikidump) DownloadAll(ctx context.Context, dir string, filenames ...string) error {
+	if err := w.CheckFor(filenames...); err != nil {
+		return err
+	}
+	for _, filename := range filenames {
+		for _, fi := range w.file2Info[filename] {
+			dst := filepath.Join(dir, path.Base(fi.URL))
+			if w.progress.completed(dst, fi) {
+				continue
+			}
+			if verifyFile(dst, fi) == nil {
+				w.progress.record(dst, fi)
+				continue
+			}
+
+			fi := fi
+			if err := w.stubbornly(ctx, fi.URL, func() error { return w.downloadTo(ctx, fi, dst) }); err != nil {
+				return err
+			}
+			w.progress.record(dst, fi)
+		}
+	}
+	return nil
+}
+
+// Download stores in destPath the decompressed content of filename, concatenating its parts in order as read from OpenAll,
+// which verifies them. destPath is written atomically: it's replaced only once all the parts have been stored.
+func (w Wikidump) Download(ctx context.Context, filename, destPath string) (err error) {
+	if err = w.CheckFor(filename); err != nil {
+		return
+	}
+	tempFile, err := ioutil.TempFile(filepath.Dir(destPath), filepath.Base(destPath))
+	if err != nil {
+		return errors.Wrap(err, "Error: unable to create temporary file in "+filepath.Dir(destPath))
+	}
+	defer func() {
+		if err != nil {
+			tempFile.Close()
+			os.Remove(tempFile.Name())
+		}
+	}()
+
+	r := w.openAll(ctx, filename)
+	defer r.Close() //releases the parts stored ahead if a part fails
+	if _, err = io.Copy(tempFile, r); err != nil {
+		return errors.Wrap(err, "Error: unable to copy to the following file: "+tempFile.Name())
+	}
+
+	if err = tempFile.Close(); err != nil {
+		return errors.Wrap(err, "Error: unable to close the following file: "+tempFile.Name())
+	}
+	return errors.Wrap(os.Rename(tempFile.Name(), destPath), "Error: unable to rename the following file: "+tempFile.Name())
+}
+
+// downloadTo atomically stores in dst the resource associated with fi. The temporary file is prefixed by ".tmp-",
+// as moveFile does, since RepairCache downloads into the cache.
+func (w Wikidump) downloadTo(ctx context.Context, fi fileInfo, dst string) (err error) {
+	tempFile, err := ioutil.TempFile(filepath.Dir(dst), ".tmp-"+filepath.Base(dst))
+	if err != nil {
+		return errors.Wrap(err, "Error: unable to create temporary file in "+filepath.Dir(dst))
+	}
+	defer func() {
+		if err != nil {
+			tempFile.Close()
+			os.Remove(tempFile.Name())
+		}
+	}()
+
+	if err = w.fetch(ctx, fi, tempFile); err != nil {
+		return
+	}
+
+	if err = tempFile.Close(); err != nil {
+		return errors.Wrap(err, "Error: unable to close the following file: "+tempFile.Name())
+	}
+
+	return errors.Wrap(os.Rename(tempFile.Name(), dst), "Error: unable to rename the following file: "+tempFile.Name())
+}
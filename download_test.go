@@ -0,0 +1,153 @@
+package wikidump
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDownloadAll(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		w.Write(name2MyInfo[r.URL.Path].Data)
+	}))
+	defer server.Close()
+
+	ffi := make([]fileInfo, 0, len(name2MyInfo))
+	for name, info := range name2MyInfo {
+		ffi = append(ffi, fileInfo{URL: server.URL + name, SHA1: info.SHA1})
+	}
+	tDump := Wikidump{file2Info: map[string][]fileInfo{"helloword": ffi}}
+
+	dir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//helloword.gz is valid, helloword.bz2 is corrupted and helloword.7z is missing
+	if err := ioutil.WriteFile(filepath.Join(dir, "helloword.gz"), name2MyInfo["/helloword.gz"].Data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "helloword.bz2"), []byte("corrupted"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tDump.DownloadAll(context.Background(), dir, "helloword"); err != nil {
+		t.Fatal("DownloadAll returns ", err)
+	}
+
+	expected := map[string]int{"/helloword.bz2": 1, "/helloword.7z": 1}
+	for name, info := range name2MyInfo {
+		if requests[name] != expected[name] {
+			t.Error(name, "should be requested", expected[name], "times, while it's requested", requests[name], "times")
+		}
+		if sha1, err := fileSHA1(filepath.Join(dir, filepath.Base(name))); err != nil || sha1 != info.SHA1 {
+			t.Error(name, "is not stored correctly: ", err)
+		}
+	}
+
+	if err := tDump.DownloadAll(context.Background(), dir, "nothing"); err == nil {
+		t.Error("Error should be not null")
+	}
+}
+
+func TestDownloadAllMissing(t *testing.T) {
+	server, requests := countingServer()
+	defer server.Close()
+
+	gz := fileInfo{URL: server.URL + "/helloword.gz", SHA1: name2MyInfo["/helloword.gz"].SHA1}
+	tDump := Wikidump{file2Info: map[string][]fileInfo{"helloword": {gz}}}
+
+	dir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = tDump.DownloadAll(context.Background(), dir, "helloword", "nothing", "nobody")
+	if !errors.Is(err, ErrFileNotFound) || !strings.Contains(err.Error(), "nothing, nobody") {
+		t.Error("DownloadAll should return ErrFileNotFound listing the missing files, while it returns ", err)
+	}
+	if requests("/helloword.gz") != 0 {
+		t.Error("Nothing should be downloaded when some files are missing")
+	}
+}
+
+func TestDownload(t *testing.T) {
+	server, _ := countingServer()
+	defer server.Close()
+
+	gz := fileInfo{URL: server.URL + "/helloword.gz", SHA1: name2MyInfo["/helloword.gz"].SHA1}
+	bz2 := fileInfo{URL: server.URL + "/helloword.bz2", SHA1: name2MyInfo["/helloword.bz2"].SHA1}
+	tDump, err := Wikidump{file2Info: map[string][]fileInfo{
+		"helloword": {gz, bz2},
+		"corrupted": {gz, {URL: bz2.URL, SHA1: "corrupted"}},
+	}}.With(WithShouldRetry(func(error, int) bool { return false }))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+
+	dir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dst := filepath.Join(dir, "helloword.txt")
+	if err := tDump.Download(context.Background(), "helloword", dst); err != nil {
+		t.Fatal("Download returns ", err)
+	}
+	if data, err := ioutil.ReadFile(dst); err != nil || string(data) != helloword+helloword {
+		t.Errorf("Download stores %q %v", data, err)
+	}
+
+	//a failed download leaves the destination untouched
+	if err := tDump.Download(context.Background(), "corrupted", dst); !errors.Is(err, ErrChecksumMismatch) {
+		t.Error("Download should return ErrChecksumMismatch, while it returns ", err)
+	}
+	if data, _ := ioutil.ReadFile(dst); string(data) != helloword+helloword {
+		t.Errorf("A failed download overwrites the destination with %q", data)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Error("A failed download should leave no temporary file, while there are", len(files), "files")
+	}
+
+	//the parts stored ahead of a failed one are released
+	tmpDir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	truncated := name2MyInfo["/helloword.gz"].Data[:35]
+	invalidServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(truncated)
+	}))
+	defer invalidServer.Close()
+	invalid := fileInfo{URL: invalidServer.URL + "/invalid.gz", SHA1: sha1Of(truncated)}
+	sDump, err := Wikidump{tmpDir: tmpDir, file2Info: map[string][]fileInfo{"invalid": {gz, invalid, gz, gz}}}.With(WithShuffledParts(true))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	if err := sDump.Download(context.Background(), "invalid", dst); err == nil {
+		t.Error("Download should fail for an invalid part")
+	}
+	if files, _ := ioutil.ReadDir(tmpDir); len(files) != 0 {
+		t.Error("A failed download should release the parts stored ahead, while", len(files), "files are left")
+	}
+
+	if err := tDump.Download(context.Background(), "nothing", dst); !errors.Is(err, ErrFileNotFound) {
+		t.Error("Download should return ErrFileNotFound, while it returns ", err)
+	}
+}
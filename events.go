@@ -0,0 +1,177 @@
+package wikidump
+
+import (
+	"context"
+	"time"
+)
+
+// EventKind is the stage of the lifecycle of a download reported by an Event.
+type EventKind int
+
+const (
+	// Started is sent before each attempt at downloading a resource.
+	Started EventKind = iota
+	// Progress is sent as the resource is received, with the bytes received so far, including the ones stored by
+	// the previous attempts of a resumed download, and the estimated time to complete the part and its file.
+	Progress
+	// Verified is sent when the checksum (SHA256, SHA1 or MD5, see WithSHA256Sums/WithMD5Sums) of the received resource
+	// matches the expected one.
+	Verified
+	// Failed is sent when an attempt fails, with its error. The download may be retried.
+	Failed
+	// Completed is sent when the resource has been downloaded and stored.
+	Completed
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case Started:
+		return "Started"
+	case Progress:
+		return "Progress"
+	case Verified:
+		return "Verified"
+	case Failed:
+		return "Failed"
+	case Completed:
+		return "Completed"
+	}
+	return "Unknown"
+}
+
+// Event describes a stage of the lifecycle of the download of the resource at URL.
+type Event struct {
+	Kind    EventKind
+	URL     string
+	Attempt int   // set for Started and Failed
+	Bytes   int64 // set for Progress
+	Err     error // set for Failed
+
+	// Set for Progress: the resource is the Part-th of the Parts of its file, starting from 1, and Size bytes long.
+	// ETA estimates the time left for the part and TotalETA for the remaining parts too, assuming they are downloaded
+	// sequentially at the current throughput. Estimates are zero if the sizes are not in the index.
+	Part, Parts   int
+	Size          int64
+	ETA, TotalETA time.Duration
+}
+
+// WithEvents sets a channel receiving the lifecycle events of the downloads. Sends wait for the receiver up to
+// eventTimeout or until the context of the download is done, then the event is dropped and counted in Stats,
+// so that a receiver not draining the channel can't block the downloads. Progress events are dropped
+// without waiting if the receiver isn't ready.
+func WithEvents(events chan<- Event) Option {
+	return func(w *Wikidump) error {
+		w.events = events
+		return nil
+	}
+}
+
+// WithProgress sets a function receiving the progress of the downloads, at most every progressInterval and when each one ends:
+// filename is the base name of the resource, done the bytes received so far and total its size according to the
+// Content-Length of the response, or -1 if unknown. Unlike WithEvents, the calls are synchronous with the download.
+func WithProgress(progress func(filename string, done, total int64)) Option {
+	return func(w *Wikidump) error {
+		w.progressFunc = progress
+		return nil
+	}
+}
+
+// progressInterval is the minimum interval between the calls of the function set by WithProgress for a download.
+const progressInterval = 500 * time.Millisecond
+
+// progressReporter reports to the function set by WithProgress the bytes written, throttled by progressInterval.
+type progressReporter struct {
+	report      func(filename string, done, total int64)
+	name        string
+	done, total int64
+	reported    int64 //bytes at the last report, -1 if none
+	last        time.Time
+}
+
+func newProgressReporter(report func(filename string, done, total int64), name string, done, total int64) *progressReporter {
+	return &progressReporter{report: report, name: name, done: done, total: total, reported: -1}
+}
+
+func (p *progressReporter) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+	if now := time.Now(); now.Sub(p.last) >= progressInterval {
+		p.last, p.reported = now, p.done
+		p.report(p.name, p.done, p.total)
+	}
+	return len(b), nil
+}
+
+// Flush reports the bytes written since the last report, if any. It's a no-op on a nil reporter.
+func (p *progressReporter) Flush() {
+	if p == nil || p.done == p.reported {
+		return
+	}
+	p.reported = p.done
+	p.report(p.name, p.done, p.total)
+}
+
+// eventTimeout bounds the wait for the receiver of an event, it's a variable so that tests can replace it.
+var eventTimeout = 5 * time.Second
+
+// emit sends e on the events channel, if any.
+func (w Wikidump) emit(ctx context.Context, e Event) {
+	if w.events == nil {
+		return
+	}
+	if e.Kind == Progress {
+		select {
+		case w.events <- e:
+		default:
+		}
+		return
+	}
+	timer := time.NewTimer(eventTimeout)
+	defer timer.Stop()
+	select {
+	case w.events <- e:
+	case <-ctx.Done():
+	case <-timer.C:
+		w.stats.update(func(s *Stats) { s.DroppedEvents++ })
+	}
+}
+
+// progressWriter emits a Progress event for each write of the resource described by fi.
+type progressWriter struct {
+	ctx   context.Context
+	w     Wikidump
+	fi    fileInfo
+	start time.Time
+	n     int64
+	from  int64 //bytes stored by previous attempts, before start
+
+	part, parts int
+	later       int64 //size of the parts following this one
+}
+
+func newProgressWriter(ctx context.Context, w Wikidump, fi fileInfo, stored int64) *progressWriter {
+	p := &progressWriter{ctx: ctx, w: w, fi: fi, start: time.Now(), n: stored, from: stored}
+	for _, ffi := range w.file2Info {
+		for i := range ffi {
+			if ffi[i].URL != fi.URL {
+				continue
+			}
+			p.part, p.parts = i+1, len(ffi)
+			for _, next := range ffi[i+1:] {
+				p.later += next.Size
+			}
+		}
+	}
+	return p
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.n += int64(len(b))
+	e := Event{Kind: Progress, URL: p.fi.URL, Bytes: p.n, Part: p.part, Parts: p.parts, Size: p.fi.Size}
+	if remaining := p.fi.Size - p.n; p.fi.Size > 0 && remaining >= 0 && p.n > p.from {
+		perByte := float64(time.Since(p.start)) / float64(p.n-p.from) //throughput of the current attempt
+		e.ETA = time.Duration(perByte * float64(remaining))
+		e.TotalETA = time.Duration(perByte * float64(remaining+p.later))
+	}
+	p.w.emit(p.ctx, e)
+	return len(b), nil
+}
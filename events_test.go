@@ -0,0 +1,210 @@
+package wikidump
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	events := make(chan Event, 100)
+	tDump, err := Wikidump{}.With(WithEvents(events))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+
+	server, _ := countingServer()
+	defer server.Close()
+
+	fi := fileInfo{URL: server.URL + "/helloword.gz", SHA1: name2MyInfo["/helloword.gz"].SHA1}
+	r, err := tDump.stubbornStore(context.Background(), fi)
+	if err != nil {
+		t.Fatal("stubbornStore returns ", err)
+	}
+	r.Close()
+	close(events)
+
+	var kinds []EventKind
+	var received int64
+	for e := range events {
+		if e.URL != fi.URL {
+			t.Error("Event for unexpected url: ", e.URL)
+		}
+		if e.Kind == Progress {
+			received = e.Bytes
+			if len(kinds) > 0 && kinds[len(kinds)-1] == Progress {
+				continue
+			}
+		}
+		kinds = append(kinds, e.Kind)
+	}
+	expected := []EventKind{Started, Progress, Verified, Completed}
+	if !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("Events should be %v but they're %v", expected, kinds)
+	}
+	if received != int64(len(name2MyInfo["/helloword.gz"].Data)) {
+		t.Error("Progress should report", len(name2MyInfo["/helloword.gz"].Data), "bytes, while it reports", received)
+	}
+
+	//nobody drains the channel, the download is not blocked once the context is done
+	tDump, _ = tDump.With(WithEvents(make(chan Event)))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := tDump.stubbornStore(ctx, fi); err == nil {
+		t.Error("stubbornStore should fail with a done context")
+	}
+	//nor with a context never done, the events are dropped after eventTimeout and counted
+	defer func(old time.Duration) { eventTimeout = old }(eventTimeout)
+	eventTimeout = 10 * time.Millisecond
+	tDump = newWikidump("", "en", time.Now(), dumpStatus{})
+	tDump, _ = tDump.With(WithEvents(make(chan Event)))
+	done := make(chan error, 1)
+	go func() {
+		r, err := tDump.stubbornStore(context.Background(), fi)
+		if err == nil {
+			r.Close()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error("stubbornStore returns ", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stubbornStore should not be blocked by an undrained channel")
+	}
+	if dropped := tDump.Stats().DroppedEvents; dropped != 3 {
+		t.Error("Started, Verified and Completed should be dropped, while the dropped events are ", dropped)
+	}
+}
+
+func TestProgressETA(t *testing.T) {
+	//each part is served in slow chunks
+	const chunk, chunks = 1024, 8
+	data := strings.Repeat("x", chunk*chunks)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < chunks; i++ {
+			w.Write([]byte(data[i*chunk : (i+1)*chunk]))
+			w.(http.Flusher).Flush()
+			time.Sleep(5 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	sum := fmt.Sprintf("%x", sha1.Sum([]byte(data)))
+	ffi := []fileInfo{
+		{URL: server.URL + "/part1.txt", SHA1: sum, Size: int64(len(data))},
+		{URL: server.URL + "/part2.txt", SHA1: sum, Size: int64(len(data))},
+	}
+	events := make(chan Event, 1000)
+	tDump, err := Wikidump{file2Info: map[string][]fileInfo{"parts": ffi}}.With(WithEvents(events))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	for _, fi := range ffi {
+		r, err := tDump.stubbornStore(context.Background(), fi)
+		if err != nil {
+			t.Fatal("stubbornStore returns ", err)
+		}
+		r.Close()
+	}
+	close(events)
+
+	part2Progress := map[int][]Event{}
+	for e := range events {
+		if e.Kind != Progress {
+			continue
+		}
+		if e.URL != ffi[e.Part-1].URL || e.Parts != 2 || e.Size != int64(len(data)) {
+			t.Errorf("Progress event with wrong part: %+v", e)
+		}
+		part2Progress[e.Part] = append(part2Progress[e.Part], e)
+	}
+	for part := 1; part <= 2; part++ {
+		progress := part2Progress[part]
+		if len(progress) < 2 {
+			t.Fatal("Too few progress events for part ", part)
+		}
+		first, last := progress[0], progress[len(progress)-1]
+		if !(first.ETA > last.ETA && last.ETA == 0) {
+			t.Error("ETA should decrease to zero, while it goes from", first.ETA, "to", last.ETA)
+		}
+		for _, e := range progress {
+			if part == 1 && e.TotalETA <= e.ETA || part == 2 && e.TotalETA != e.ETA {
+				t.Errorf("TotalETA should account for the remaining parts: %+v", e)
+			}
+		}
+	}
+}
+
+func TestProgressResumed(t *testing.T) {
+	events := make(chan Event, 1)
+	tDump, err := Wikidump{}.With(WithEvents(events))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+
+	//900 bytes were stored by a previous attempt, the estimate relies on the 50 received by this one
+	start := time.Now()
+	p := newProgressWriter(context.Background(), tDump, fileInfo{URL: "https://dumps.wikimedia.org/resumed.txt", Size: 1000}, 900)
+	time.Sleep(10 * time.Millisecond)
+	p.Write(make([]byte, 50))
+	elapsed := time.Since(start)
+	e := <-events
+	if e.Bytes != 950 {
+		t.Error("Progress should count the bytes stored by the previous attempts, while it reports", e.Bytes)
+	}
+	if e.ETA <= 0 || e.ETA > elapsed {
+		t.Error("The ETA of the remaining 50 bytes should be at most", elapsed, "while it's", e.ETA)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	data := []byte(strings.Repeat("wikidump", 512))
+	sum := fmt.Sprintf("%x", sha1.Sum(data))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sized" {
+			w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		}
+		for i := 0; i < 4; i++ {
+			w.Write(data[i*len(data)/4 : (i+1)*len(data)/4])
+			w.(http.Flusher).Flush()
+			time.Sleep(200 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	type call struct {
+		filename    string
+		done, total int64
+	}
+	var calls []call
+	tDump, err := Wikidump{}.With(WithProgress(func(filename string, done, total int64) {
+		calls = append(calls, call{filename, done, total})
+	}))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	for path, total := range map[string]int64{"/sized": int64(len(data)), "/unsized": -1} {
+		calls = nil
+		r, err := tDump.stubbornStore(context.Background(), fileInfo{URL: server.URL + path, SHA1: sum})
+		if err != nil {
+			t.Fatal("stubbornStore returns ", err)
+		}
+		r.Close()
+
+		if len(calls) < 2 || len(calls) > 3 {
+			t.Error("The progress should be reported at most every", progressInterval, "while it's reported", len(calls), "times:", calls)
+		}
+		if last := calls[len(calls)-1]; last != (call{path[1:], int64(len(data)), total}) {
+			t.Error("The last report should be for the whole download, while it's", last)
+		}
+	}
+}
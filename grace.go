@@ -0,0 +1,74 @@
+package wikidump
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WithGrace makes the context of a download a soft limit: when it's done, a download that already received
+// at least fraction of its size gets up to grace more time to complete, while the others are cancelled right away.
+// Downloads not started yet are skipped. It applies only to resources whose size is reported by the index.
+// A resource downloaded within grace gets as much more time to be decompressed, as its 7z extraction would
+// otherwise be cancelled right away.
+func WithGrace(fraction float64, grace time.Duration) Option {
+	return func(w *Wikidump) error {
+		if fraction <= 0 || fraction > 1 || grace <= 0 {
+			return errors.Errorf("Error: invalid grace of %v for downloads %v complete", grace, fraction)
+		}
+		w.graceFraction, w.grace = fraction, grace
+		return nil
+	}
+}
+
+// withGrace returns a context that survives parent for up to w.grace, once received reaches the grace fraction of fi.
+func (w Wikidump) withGrace(parent context.Context, fi fileInfo, received *int64) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(detached{parent})
+	go func() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-parent.Done():
+		}
+		if float64(atomic.LoadInt64(received)) >= w.graceFraction*float64(fi.Size) {
+			w.logf("Deadline reached while downloading the following url: %v, granting a grace of %v", redactURL(fi.URL), w.grace)
+			select {
+			case <-ctx.Done():
+			case <-time.After(w.grace):
+			}
+		}
+		cancel()
+	}()
+	return ctx, cancel
+}
+
+// graceAfterDownload returns the context decompressing fi once downloaded: if parent is already done and fi
+// is subject to grace, a context that survives parent for up to w.grace, otherwise parent itself.
+func (w Wikidump) graceAfterDownload(parent context.Context, fi fileInfo) (context.Context, context.CancelFunc) {
+	if w.grace <= 0 || fi.Size <= 0 || parent.Err() == nil {
+		return parent, func() {}
+	}
+	return context.WithTimeout(detached{parent}, w.grace)
+}
+
+// detached is a context carrying the values of its parent, but neither its deadline nor its cancellation.
+type detached struct {
+	parent context.Context
+}
+
+func (detached) Deadline() (deadline time.Time, ok bool) { return }
+func (detached) Done() <-chan struct{}                   { return nil }
+func (detached) Err() error                              { return nil }
+func (d detached) Value(key interface{}) interface{}     { return d.parent.Value(key) }
+
+// countingWriter counts atomically the bytes written.
+type countingWriter struct {
+	n *int64
+}
+
+func (c countingWriter) Write(b []byte) (int, error) {
+	atomic.AddInt64(c.n, int64(len(b)))
+	return len(b), nil
+}
@@ -0,0 +1,98 @@
+package wikidump
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGrace(t *testing.T) {
+	//the server stalls when the body is almost complete
+	data := strings.Repeat("x", 1000)
+	stalled := make(chan struct{})
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		w.Write([]byte(data[:900]))
+		w.(http.Flusher).Flush()
+		close(stalled)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(data[900:]))
+	}))
+	defer server.Close()
+
+	tDump, err := Wikidump{}.With(WithGrace(0.8, 5*time.Second))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	sum := fmt.Sprintf("%x", sha1.Sum([]byte(data)))
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stalled
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	var b bytes.Buffer
+	if err := tDump.fetch(ctx, fileInfo{URL: server.URL + "/almost.txt", SHA1: sum, Size: int64(len(data))}, &b); err != nil {
+		t.Fatal("The almost complete download should finish within grace, while fetch returns ", err)
+	}
+	if b.String() != data {
+		t.Error("Unexpected content downloaded")
+	}
+
+	//new downloads are skipped
+	if err := tDump.fetch(ctx, fileInfo{URL: server.URL + "/new.txt", SHA1: sum, Size: int64(len(data))}, &b); err == nil {
+		t.Error("The new download should be skipped")
+	}
+	if atomic.LoadInt64(&requests) != 1 {
+		t.Error("The new download should not be requested")
+	}
+
+	if _, err := tDump.With(WithGrace(1.5, time.Second)); err == nil {
+		t.Error("WithGrace(1.5, ...) should return an error")
+	}
+}
+
+func TestGraceDecompression(t *testing.T) {
+	data := name2MyInfo["/helloword.7z"].Data
+	stalled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data[:len(data)-1])
+		w.(http.Flusher).Flush()
+		close(stalled)
+		time.Sleep(100 * time.Millisecond)
+		w.Write(data[len(data)-1:])
+	}))
+	defer server.Close()
+
+	tDump, err := Wikidump{}.With(WithGrace(0.8, 5*time.Second), WithArchiver(&fakeArchiver{}))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stalled
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	//the archive downloaded within grace can be extracted, even if the context is done
+	fi := fileInfo{URL: server.URL + "/helloword.7z", SHA1: name2MyInfo["/helloword.7z"].SHA1, Size: int64(len(data))}
+	r, err := tDump.open(ctx, fi)
+	if err != nil {
+		t.Fatal("open returns ", err)
+	}
+	defer r.Close()
+	if content, err := ioutil.ReadAll(r); err != nil || string(content) != helloword {
+		t.Error("Reading the archive downloaded within grace returns ", string(content), err)
+	}
+}
@@ -0,0 +1,108 @@
+package wikidump
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// ErrGzipTrailer is returned when the trailer of a gzip file doesn't match the expected content.
+var ErrGzipTrailer = errors.New("gzip trailer mismatch")
+
+// CheckGzipTrailer screens quickly the gzip file at path reading only its last 8 bytes, where the CRC32 and
+// the size modulo 2^32 (ISIZE) of the uncompressed content are stored: the size must match size and, if crc is not zero,
+// the CRC32 must match crc, as computed by crc32.ChecksumIEEE. For multi-member files the trailer refers to the last member only, and in any case
+// passing the check doesn't guarantee integrity as a SHA1 verification does.
+func CheckGzipTrailer(path string, size int64, crc uint32) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "Error: unable to open the following file: "+path)
+	}
+	defer f.Close()
+
+	trailer := make([]byte, 8)
+	if _, err := f.Seek(-8, io.SeekEnd); err != nil {
+		return errors.Wrap(ErrGzipTrailer, "no trailer in the following file: "+path)
+	}
+	if _, err := io.ReadFull(f, trailer); err != nil {
+		return errors.Wrap(err, "Error: unable to read the trailer of the following file: "+path)
+	}
+
+	storedCRC, storedSize := binary.LittleEndian.Uint32(trailer[:4]), binary.LittleEndian.Uint32(trailer[4:])
+	switch {
+	case storedSize != uint32(size):
+		return errors.Wrap(ErrGzipTrailer, "stored size "+strconv.FormatUint(uint64(storedSize), 10)+" in the following file: "+path)
+	case crc != 0 && storedCRC != crc:
+		return errors.Wrap(ErrGzipTrailer, "stored CRC32 "+strconv.FormatUint(uint64(storedCRC), 16)+" in the following file: "+path)
+	}
+	return nil
+}
+
+// gzipScanLimit bounds the decompressed bytes read to tell apart multi-member gzip files failing the pre-check.
+var gzipScanLimit int64 = 64 << 20
+
+// WithGzipPrecheck sets a function returning the uncompressed size of the gzip resource at url, when known, overriding
+// the one reported by the index, if any. VerifyMirror and RepairCache screen the gzip resources of known uncompressed size
+// with CheckGzipTrailer before computing their checksum, reporting the ones failing the check as corrupt without reading
+// them entirely. As the trailer of a multi-member file describes only its last member, files failing the check are
+// reported as corrupt only if their first member turns out to be the last one within the first 64MiB of its content,
+// while the others are left to the checksum. By default the sizes are the ones reported by the index.
+func WithGzipPrecheck(uncompressedSize func(url string) (size int64, ok bool)) Option {
+	return func(w *Wikidump) error {
+		w.gzipSize = uncompressedSize
+		return nil
+	}
+}
+
+// passesGzipPrecheck reports whether the file at path storing fi passes the gzip pre-check, if it applies.
+func (w Wikidump) passesGzipPrecheck(fi fileInfo, path string) bool {
+	if formatOf(fi.URL) != "gzip" {
+		return true
+	}
+	size, ok := fi.UncompressedSize, fi.UncompressedSize > 0
+	if w.gzipSize != nil {
+		if s, sOK := w.gzipSize(fi.URL); sOK {
+			size, ok = s, true
+		}
+	}
+	if !ok {
+		return true
+	}
+	if err := CheckGzipTrailer(path, size, 0); !errors.Is(err, ErrGzipTrailer) {
+		return true
+	}
+	multi, known, err := multiMember(path, gzipScanLimit)
+	return err == nil && (multi || !known)
+}
+
+// multiMember reports whether the gzip file at path has more than one member, decompressing at most limit bytes of
+// its first member: if it's longer, known is false.
+func multiMember(path string, limit int64) (multi, known bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, false, errors.Wrap(err, "Error: unable to open the following file: "+path)
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	r, err := gzip.NewReader(br)
+	if err != nil {
+		return false, false, errors.Wrap(err, "Error: unable to read the following file: "+path)
+	}
+	r.Multistream(false)
+	n, err := io.Copy(ioutil.Discard, io.LimitReader(r, limit+1))
+	switch {
+	case err != nil:
+		return false, false, errors.Wrap(err, "Error: unable to decompress the following file: "+path)
+	case n > limit:
+		return false, false, nil
+	}
+	_, err = br.Peek(1)
+	return err == nil, true, nil
+}
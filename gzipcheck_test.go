@@ -0,0 +1,157 @@
+package wikidump
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheckGzipTrailer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := name2MyInfo["/helloword.gz"].Data
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)-1]++
+	validPath, tamperedPath := filepath.Join(dir, "valid.gz"), filepath.Join(dir, "tampered.gz")
+	if err := ioutil.WriteFile(validPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(tamperedPath, tampered, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	size, crc := int64(len(helloword)), crc32.ChecksumIEEE([]byte(helloword))
+	if err := CheckGzipTrailer(validPath, size, crc); err != nil {
+		t.Error("CheckGzipTrailer returns ", err)
+	}
+	if err := CheckGzipTrailer(validPath, size, crc+1); !errors.Is(err, ErrGzipTrailer) {
+		t.Error("CheckGzipTrailer should detect a wrong CRC32, while it returns ", err)
+	}
+	if err := CheckGzipTrailer(tamperedPath, size, 0); !errors.Is(err, ErrGzipTrailer) {
+		t.Error("CheckGzipTrailer should detect a tampered trailer, while it returns ", err)
+	}
+
+	//the tampered file matches its SHA1 sum, but it's reported as corrupt by the pre-check
+	tamperedSHA1, err := fileSHA1(tamperedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tDump, err := Wikidump{file2Info: map[string][]fileInfo{
+		"valid":    {{URL: "https://dumps.wikimedia.org/valid.gz", SHA1: name2MyInfo["/helloword.gz"].SHA1}},
+		"tampered": {{URL: "https://dumps.wikimedia.org/tampered.gz", SHA1: tamperedSHA1}},
+	}}.With(WithGzipPrecheck(func(url string) (int64, bool) { return size, true }))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	report, err := tDump.VerifyMirror(context.Background(), dir)
+	if err != nil {
+		t.Fatal("VerifyMirror returns ", err)
+	}
+	expected := Report{Verified: []string{validPath}, Corrupt: []string{tamperedPath}}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("Report should be %+v but it's %+v", expected, report)
+	}
+}
+
+func TestGzipPrecheckWithoutSums(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := name2MyInfo["/helloword.gz"].Data
+	intactPath, truncatedPath := filepath.Join(dir, "intact.gz"), filepath.Join(dir, "truncated.gz")
+	if err := ioutil.WriteFile(intactPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(truncatedPath, data[:len(data)-4], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	//without a sum in the index only the pre-check tells something about the files
+	tDump, err := Wikidump{file2Info: map[string][]fileInfo{
+		"intact":    {{URL: "https://dumps.wikimedia.org/intact.gz"}},
+		"truncated": {{URL: "https://dumps.wikimedia.org/truncated.gz"}},
+	}}.With(WithGzipPrecheck(func(url string) (int64, bool) { return int64(len(helloword)), true }))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	report, err := tDump.VerifyMirror(context.Background(), dir)
+	if err != nil {
+		t.Fatal("VerifyMirror returns ", err)
+	}
+	expected := Report{Unverified: []string{intactPath}, Corrupt: []string{truncatedPath}}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("Report should be %+v but it's %+v", expected, report)
+	}
+}
+
+func TestGzipPrecheckMultiMember(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//the trailer describes only the last member, so the size of the whole content doesn't match it
+	data := name2MyInfo["/helloword.gz"].Data
+	multiPath := filepath.Join(dir, "multi.gz")
+	if err := ioutil.WriteFile(multiPath, append(append([]byte{}, data...), data...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tDump, err := Wikidump{}.With(WithGzipPrecheck(func(url string) (int64, bool) { return int64(2 * len(helloword)), true }))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	fi := fileInfo{URL: "https://dumps.wikimedia.org/multi.gz"}
+	if err := CheckGzipTrailer(multiPath, int64(2*len(helloword)), 0); !errors.Is(err, ErrGzipTrailer) {
+		t.Error("CheckGzipTrailer should fail on the whole size of a multi-member file, while it returns ", err)
+	}
+	if !tDump.passesGzipPrecheck(fi, multiPath) {
+		t.Error("A valid multi-member file should not be reported as corrupt by the pre-check")
+	}
+}
+
+func TestGzipPrecheckDefault(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := name2MyInfo["/helloword.gz"].Data
+	path := filepath.Join(dir, "helloword.gz")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	//without an override the size reported by the index applies
+	fi := fileInfo{URL: "https://dumps.wikimedia.org/helloword.gz", UncompressedSize: int64(len(helloword)) + 1}
+	if (Wikidump{}).passesGzipPrecheck(fi, path) {
+		t.Error("A file mismatching the uncompressed size reported by the index should fail the pre-check")
+	}
+	tDump, err := Wikidump{}.With(WithGzipPrecheck(func(url string) (int64, bool) { return int64(len(helloword)), true }))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	if !tDump.passesGzipPrecheck(fi, path) {
+		t.Error("The size returned by WithGzipPrecheck should override the one reported by the index")
+	}
+
+	//members longer than the scan limit are left to the checksum
+	defer func(old int64) { gzipScanLimit = old }(gzipScanLimit)
+	gzipScanLimit = int64(len(helloword)) - 1
+	if !(Wikidump{}).passesGzipPrecheck(fi, path) {
+		t.Error("A file whose first member exceeds the scan limit should be left to the checksum")
+	}
+}
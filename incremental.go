@@ -0,0 +1,76 @@
+package wikidump
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// incrementalURL returns the url of the directory of the adds-changes dumps of lang, or of the one of date t if not zero.
+func incrementalURL(lang string, t time.Time) string {
+	dirURL := fmt.Sprintf("%v/other/incr/%vwiki/", dumpsURL, strings.Replace(lang, "-", "_", -1))
+	if !t.IsZero() {
+		dirURL += t.Format("20060102") + "/"
+	}
+	return dirURL
+}
+
+// IncrementalDates returns the sorted dates of the daily adds-changes dumps of lang, as Dumps.IncrementalDates does.
+func IncrementalDates(ctx context.Context, lang string) ([]time.Time, error) {
+	return Dumps{}.IncrementalDates(ctx, lang)
+}
+
+// IncrementalDates returns the sorted dates of the daily adds-changes dumps of lang, including the ones in progress.
+// They can be passed to Incremental.
+func (d Dumps) IncrementalDates(ctx context.Context, lang string) ([]time.Time, error) {
+	return d.listDates(ctx, incrementalURL(lang, time.Time{}), lang)
+}
+
+// Incremental creates a new wikidump from the daily adds-changes dump of the specified date, as Dumps.Incremental does.
+func Incremental(ctx context.Context, tmpDir, lang string, t time.Time) (Wikidump, error) {
+	return Dumps{}.Incremental(ctx, tmpDir, lang, t)
+}
+
+// Incremental creates a new wikidump from the daily adds-changes dump of the specified date, with its temporary files
+// in tmpDir as in Latest. It fails with ErrIncompleteDump if the dump is not done. Its files are named after their
+// resources without the wiki, the date, the extensions and the dashes, as "pagesmetahistincr" and "stubsmetahistincr",
+// and they're verified with the MD5 sums published along with them.
+func (d Dumps) Incremental(ctx context.Context, tmpDir, lang string, t time.Time) (Wikidump, error) {
+	if err := checkTmpDir(tmpDir); err != nil {
+		return Wikidump{}, err
+	}
+	dirURL := incrementalURL(lang, t)
+	status, err := d.fetchPage(ctx, dirURL+"status.txt")
+	if err != nil {
+		return Wikidump{}, err
+	}
+	if !strings.HasPrefix(strings.TrimSpace(string(status)), "done") {
+		return Wikidump{}, errors.Wrapf(ErrIncompleteDump, "Error: the %v adds-changes dump of %v is %q", lang, t.Format("20060102"), strings.TrimSpace(string(status)))
+	}
+
+	prefix := fmt.Sprintf("%vwiki-%v-", strings.Replace(lang, "-", "_", -1), t.Format("20060102"))
+	sums, err := d.fetchPage(ctx, dirURL+prefix+"md5sums.txt")
+	if err != nil {
+		return Wikidump{}, err
+	}
+	data := dumpStatus{Jobs: map[string]jobStatus{}}
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue //invalid lines are reported by WithMD5Sums
+		}
+		name := strings.TrimPrefix(fields[1], "*")
+		file := strings.Replace(strings.SplitN(strings.TrimPrefix(name, prefix), ".", 2)[0], "-", "", -1)
+		data.Jobs[file] = jobStatus{"done", map[string]fileInfo{name: {URL: dirURL + name}}}
+	}
+	if len(data.Jobs) == 0 {
+		return Wikidump{}, errors.New("Error: no files in the MD5 sums of the following url: " + dirURL)
+	}
+	return d.newWikidump(tmpDir, lang, t, data).With(WithMD5Sums(bytes.NewReader(sums)))
+}
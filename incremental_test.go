@@ -0,0 +1,65 @@
+package wikidump
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIncremental(t *testing.T) {
+	gz := name2MyInfo["/helloword.gz"].Data
+	mux := http.NewServeMux()
+	mux.HandleFunc("/other/incr/enwiki/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<a href=\"20200101/\">20200101/</a>\n<a href=\"20200102/\">20200102/</a>\n"))
+	})
+	mux.HandleFunc("/other/incr/enwiki/20200101/status.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("done\n"))
+	})
+	mux.HandleFunc("/other/incr/enwiki/20200101/enwiki-20200101-md5sums.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%x  enwiki-20200101-stubs-meta-hist-incr.xml.gz\n", md5.Sum(gz))
+	})
+	mux.HandleFunc("/other/incr/enwiki/20200101/enwiki-20200101-stubs-meta-hist-incr.xml.gz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(gz)
+	})
+	mux.HandleFunc("/other/incr/enwiki/20200102/status.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("in-progress\n"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	defer func(old string) { dumpsURL = old }(dumpsURL)
+	dumpsURL = server.URL
+
+	dates, err := IncrementalDates(context.Background(), "en")
+	if err != nil || len(dates) != 2 || dates[0] != time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC) {
+		t.Fatal("IncrementalDates returns ", dates, err)
+	}
+
+	w, err := Incremental(context.Background(), "", "en", dates[0])
+	if err != nil {
+		t.Fatal("Incremental returns ", err)
+	}
+	if files := w.Files(); len(files) != 1 || files[0] != "stubsmetahistincr" {
+		t.Error("Incremental lists the files ", files)
+	}
+	r, err := w.Open("stubsmetahistincr")(context.Background())
+	if err != nil {
+		t.Fatal("Open returns ", err)
+	}
+	defer r.Close()
+	if data, err := ioutil.ReadAll(r); err != nil || string(data) != helloword {
+		t.Errorf("Reading returns %q %v", data, err)
+	}
+
+	if _, err := Incremental(context.Background(), "", "en", dates[1]); !errors.Is(err, ErrIncompleteDump) {
+		t.Error("Incremental should return ErrIncompleteDump, while it returns ", err)
+	}
+	if _, err := Incremental(context.Background(), "", "en", time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Error("Incremental should fail for a missing dump")
+	}
+}
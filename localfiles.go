@@ -0,0 +1,82 @@
+package wikidump
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// openLocal serves the file:// url from the local filesystem as the response to a request with header.
+// Single ranges are honoured, so that resumption, segments and SeekPage work on local files too.
+func openLocal(rawURL string, header http.Header) (io.ReadCloser, *http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, permanent(errors.Wrap(err, "Error: invalid url: "+rawURL))
+	}
+	f, err := os.Open(filepath.FromSlash(u.Path))
+	if err != nil {
+		err = errors.Wrap(err, "Error: unable to open the following url: "+rawURL)
+		if os.IsNotExist(errors.Cause(err)) {
+			err = permanent(errors.Wrap(ErrFileNotFound, err.Error()))
+		}
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, errors.Wrap(err, "Error: unable to read the following url: "+rawURL)
+	}
+
+	size := info.Size()
+	var body io.ReadCloser = f
+	resp := &http.Response{Status: "200 OK", StatusCode: http.StatusOK, Header: http.Header{}, ContentLength: size}
+	if start, end, ok := parseRange(header.Get("Range"), size); ok {
+		if start >= size {
+			f.Close()
+			return nil, nil, permanent(&StatusError{http.StatusRequestedRangeNotSatisfiable, "416 Requested Range Not Satisfiable", rawURL, "", 0})
+		}
+		if _, err := f.Seek(start, io.SeekStart); err != nil {
+			f.Close()
+			return nil, nil, errors.Wrap(err, "Error: unable to seek the following url: "+rawURL)
+		}
+		resp.Status, resp.StatusCode, resp.ContentLength = "206 Partial Content", http.StatusPartialContent, end-start
+		resp.Header.Set("Content-Range", fmt.Sprintf("bytes %v-%v/%v", start, end-1, size))
+		body = struct {
+			io.Reader
+			io.Closer
+		}{io.LimitReader(f, end-start), f}
+	}
+	resp.Body = body
+	return body, resp, nil
+}
+
+// parseRange parses a single range in the "bytes=start-" or "bytes=start-last" form, returning the bounds [start, end)
+// within a resource of the given size.
+func parseRange(value string, size int64) (start, end int64, ok bool) {
+	bounds := strings.SplitN(strings.TrimPrefix(value, "bytes="), "-", 2)
+	if !strings.HasPrefix(value, "bytes=") || len(bounds) != 2 {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false
+	}
+	end = size
+	if bounds[1] != "" {
+		last, err := strconv.ParseInt(bounds[1], 10, 64)
+		if err != nil || last < start {
+			return 0, 0, false
+		}
+		if last+1 < size {
+			end = last + 1
+		}
+	}
+	return start, end, true
+}
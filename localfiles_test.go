@@ -0,0 +1,57 @@
+package wikidump
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"/helloword.gz", "/helloword.bz2"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), name2MyInfo[name].Data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	url := func(name string) string {
+		return "file://" + filepath.ToSlash(filepath.Join(dir, name))
+	}
+
+	tDump, err := Wikidump{}.With(WithShouldRetry(func(error, int) bool { return false }))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	for _, name := range []string{"/helloword.gz", "/helloword.bz2"} {
+		r, err := tDump.open(context.Background(), fileInfo{URL: url(name), SHA1: name2MyInfo[name].SHA1})
+		if err != nil {
+			t.Fatal("open returns ", err)
+		}
+		if data, err := ioutil.ReadAll(r); err != nil || string(data) != helloword {
+			t.Error("Reading", name, "returns", string(data), err)
+		}
+		r.Close()
+	}
+
+	//ranges are served
+	data := name2MyInfo["/helloword.gz"].Data
+	r, resp, err := tDump.streamWith(context.Background(), fileInfo{URL: url("/helloword.gz")}, http.Header{"Range": {"bytes=2-5"}})
+	if err != nil {
+		t.Fatal("streamWith returns ", err)
+	}
+	if got, _ := ioutil.ReadAll(r); resp.StatusCode != http.StatusPartialContent || string(got) != string(data[2:6]) {
+		t.Error("The range should be served, while the response is", resp.Status, got)
+	}
+	r.Close()
+
+	if _, err := tDump.open(context.Background(), fileInfo{URL: url("/missing.gz")}); !errors.Is(err, ErrFileNotFound) || !isPermanent(err) {
+		t.Error("A missing file should be reported as permanent ErrFileNotFound, while it returns ", err)
+	}
+}
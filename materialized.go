@@ -0,0 +1,87 @@
+package wikidump
+
+import (
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// materialized tracks the temporary files currently storing the resources, a nil *materialized tracks nothing.
+type materialized struct {
+	mu       sync.Mutex
+	url2Path map[string]string
+}
+
+func newMaterialized() *materialized {
+	return &materialized{url2Path: map[string]string{}}
+}
+
+func (m *materialized) add(url, path string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.url2Path[url] = path
+}
+
+func (m *materialized) remove(url, path string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.url2Path[url] == path {
+		delete(m.url2Path, url)
+	}
+}
+
+func (m *materialized) get(url string) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, ok := m.url2Path[url]
+	return path, ok
+}
+
+// paths returns the paths of all the files tracked.
+func (m *materialized) paths() []string {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	paths := make([]string, 0, len(m.url2Path))
+	for _, path := range m.url2Path {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// MaterializedPaths returns the paths of the files on disk storing the resources associated with filename,
+// that are the temporary files of the resources open and not closed yet, or the cached ones.
+// It fails if some resource is not on disk, as when it's not downloaded yet or it's buffered in memory.
+func (w Wikidump) MaterializedPaths(filename string) ([]string, error) {
+	if err := w.CheckFor(filename); err != nil {
+		return nil, err
+	}
+	ffi := w.file2Info[filename]
+	paths := make([]string, len(ffi))
+	for i, fi := range ffi {
+		if path, ok := w.materialized.get(fi.URL); ok {
+			paths[i] = path
+			continue
+		}
+		if cachePath := w.cachePath(fi); cachePath != "" {
+			if _, err := os.Stat(cachePath); err == nil {
+				paths[i] = cachePath
+				continue
+			}
+		}
+		return nil, errors.New("Error: no file on disk stores the following url: " + fi.URL)
+	}
+	return paths, nil
+}
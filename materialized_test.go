@@ -0,0 +1,124 @@
+package wikidump
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaterializedPaths(t *testing.T) {
+	server, _ := countingServer()
+	defer server.Close()
+
+	tmpDir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	index := fmt.Sprintf(`{"jobs": {"helloword": {"status": "done", "files": {
+	"helloword.gz": {"url": "%v/helloword.gz", "sha1": "%v"},
+	"helloword.bz2": {"url": "%v/helloword.bz2", "sha1": "%v"}
+}}}}`, server.URL, name2MyInfo["/helloword.gz"].SHA1, server.URL, name2MyInfo["/helloword.bz2"].SHA1)
+	tDump, err := FromIndex(tmpDir, "en", strings.NewReader(index), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal("FromIndex returns ", err)
+	}
+	if _, err := tDump.MaterializedPaths("helloword"); err == nil {
+		t.Error("MaterializedPaths should fail before the download")
+	}
+
+	//the resources are materialized while they are open
+	next := tDump.Open("helloword")
+	var parts []interface{ Close() error }
+	for i := 0; i < 2; i++ {
+		r, err := next(context.Background())
+		if err != nil {
+			t.Fatal("Open returns ", err)
+		}
+		parts = append(parts, r)
+	}
+	paths, err := tDump.MaterializedPaths("helloword")
+	if err != nil {
+		t.Fatal("MaterializedPaths returns ", err)
+	}
+	for i, name := range []string{"/helloword.bz2", "/helloword.gz"} {
+		if data, err := ioutil.ReadFile(paths[i]); err != nil || string(data) != string(name2MyInfo[name].Data) {
+			t.Error("The path", paths[i], "should store", name, "but it doesn't:", err)
+		}
+	}
+
+	for _, r := range parts {
+		r.Close()
+	}
+	if _, err := tDump.MaterializedPaths("helloword"); err == nil {
+		t.Error("MaterializedPaths should fail once the resources are closed")
+	}
+}
+
+func TestClose(t *testing.T) {
+	server, _ := countingServer()
+	defer server.Close()
+
+	tmpDir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	index := fmt.Sprintf(`{"jobs": {"helloword": {"status": "done", "files": {
+	"helloword.gz": {"url": "%v/helloword.gz", "sha1": "%v"}
+}}}}`, server.URL, name2MyInfo["/helloword.gz"].SHA1)
+	tDump, err := FromIndex(tmpDir, "en", strings.NewReader(index), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal("FromIndex returns ", err)
+	}
+	if tDump, err = tDump.With(WithDedicatedTmpDir(true)); err != nil {
+		t.Fatal("With returns ", err)
+	}
+
+	r, err := tDump.Open("helloword")(context.Background())
+	if err != nil {
+		t.Fatal("The iterator returns ", err)
+	}
+	paths, err := tDump.MaterializedPaths("helloword")
+	if err != nil || !strings.HasPrefix(paths[0], tDump.ownedTmpDir) {
+		t.Fatal("The resource should be stored in the dedicated directory, while it's in ", paths, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := tDump.Close(); err != nil {
+			t.Error("Close returns ", err)
+		}
+	}
+	if _, err := os.Stat(paths[0]); !os.IsNotExist(err) {
+		t.Error("Close should remove the temporary files, while it returns ", err)
+	}
+	if infos, err := ioutil.ReadDir(tmpDir); err != nil || len(infos) != 0 {
+		t.Error("Close should remove the dedicated directory, while there are ", len(infos), err)
+	}
+	r.Close()
+}
+
+func TestDedicatedTmpDirDisabled(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tDump, err := Wikidump{tmpDir: tmpDir}.With(WithDedicatedTmpDir(true), WithDedicatedTmpDir(false))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	if tDump.tmpDir != tmpDir || tDump.ownedTmpDir != "" {
+		t.Error("Disabling the dedicated directory should restore ", tmpDir, ", while the temporary directory is ", tDump.tmpDir, tDump.ownedTmpDir)
+	}
+	if infos, err := ioutil.ReadDir(tmpDir); err != nil || len(infos) != 0 {
+		t.Error("Disabling the dedicated directory should remove it, while there are ", len(infos), err)
+	}
+}
@@ -0,0 +1,62 @@
+package wikidump
+
+import (
+	"context"
+	"sync"
+)
+
+// memoryBudget bounds the memory used concurrently by in-memory buffering, a nil *memoryBudget is unbounded.
+type memoryBudget struct {
+	mu         sync.Mutex
+	max, used  int64
+	peak       int64
+	releaseSig chan struct{} // closed and replaced each time some memory is released
+}
+
+func newMemoryBudget(max int64) *memoryBudget {
+	return &memoryBudget{max: max, releaseSig: make(chan struct{})}
+}
+
+// fits reports whether size bytes could ever be acquired.
+func (b *memoryBudget) fits(size int64) bool {
+	return b == nil || size <= b.max
+}
+
+// acquire reserves size bytes, waiting for them to be released if needed.
+func (b *memoryBudget) acquire(ctx context.Context, size int64) error {
+	if b == nil {
+		return nil
+	}
+	for {
+		b.mu.Lock()
+		if b.used+size <= b.max {
+			b.used += size
+			if b.used > b.peak {
+				b.peak = b.used
+			}
+			b.mu.Unlock()
+			return nil
+		}
+		released := b.releaseSig
+		b.mu.Unlock()
+
+		select {
+		case <-released:
+			//try again
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release frees size bytes previously acquired.
+func (b *memoryBudget) release(size int64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= size
+	close(b.releaseSig)
+	b.releaseSig = make(chan struct{})
+}
@@ -0,0 +1,54 @@
+package wikidump
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	info := name2MyInfo["/helloword.gz"]
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		w.Write(info.Data)
+	}))
+	defer server.Close()
+
+	size := int64(len(info.Data))
+	tDump, err := Wikidump{}.With(WithSpillThreshold(size), WithMemoryBudget(3*size))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := tDump.open(context.Background(), fileInfo{URL: server.URL + "/helloword.gz", SHA1: info.SHA1, Size: size})
+			if err != nil {
+				t.Error("open returns ", err)
+				return
+			}
+			defer r.Close()
+			time.Sleep(10 * time.Millisecond)
+			if data, err := ioutil.ReadAll(r); err != nil || string(data) != helloword {
+				t.Error("Reading returns ", string(data), err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	tDump.memory.mu.Lock()
+	defer tDump.memory.mu.Unlock()
+	if tDump.memory.peak > tDump.memory.max {
+		t.Error("Memory usage peaked at", tDump.memory.peak, "over the budget of", tDump.memory.max)
+	}
+	if tDump.memory.used != 0 {
+		t.Error("Memory should be released, while", tDump.memory.used, "bytes are still in use")
+	}
+}
@@ -0,0 +1,132 @@
+package wikidump
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Report summarizes the outcome of a verification, each field lists the paths of the local files in that state.
+// Unverified lists the files that are present but have no sum in the index to be checked against,
+// Repaired lists the corrupt files that have been downloaded again.
+type Report struct {
+	Verified, Unverified, Missing, Corrupt, Repaired []string
+}
+
+// VerifyMirror checks a local mirror of dumps.wikimedia.org rooted in root against the current wikidump:
+// every expected file is looked up under root following the path of its URL and its checksum is verified,
+// the strongest known among SHA256, SHA1 and MD5. Files without any of them are reported as unverified.
+// Sums are computed concurrently (see WithVerifyConcurrency), while the report follows the order of the resources.
+func (w Wikidump) VerifyMirror(ctx context.Context, root string) (report Report, err error) {
+	ffi := w.sortedInfos()
+	paths := make([]string, len(ffi))
+	for i, fi := range ffi {
+		u, err := url.Parse(fi.URL)
+		if err != nil {
+			return Report{}, errors.Wrap(err, "Error: unable to parse the following url: "+fi.URL)
+		}
+		paths[i] = filepath.Join(root, filepath.FromSlash(u.Path))
+	}
+
+	sums, err := w.checksums(ctx, ffi, paths)
+	if err != nil {
+		return Report{}, err
+	}
+	for i, sum := range sums {
+		localPath := paths[i]
+		switch {
+		case os.IsNotExist(errors.Cause(sum.err)):
+			report.Missing = append(report.Missing, localPath)
+		case sum.err != nil:
+			return Report{}, sum.err
+		case !sum.failedPrecheck && !ffi[i].hasChecksum():
+			report.Unverified = append(report.Unverified, localPath)
+		case !sum.matches(ffi[i]):
+			report.Corrupt = append(report.Corrupt, localPath)
+		default:
+			report.Verified = append(report.Verified, localPath)
+		}
+	}
+	return
+}
+
+// sortedInfos returns the infos of all the resources, sorted by filename and then in logical order.
+func (w Wikidump) sortedInfos() []fileInfo {
+	filenames := make([]string, 0, len(w.file2Info))
+	for filename := range w.file2Info {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	ffi := []fileInfo{}
+	for _, filename := range filenames {
+		ffi = append(ffi, w.file2Info[filename]...)
+	}
+	return ffi
+}
+
+type checksum struct {
+	sum            string // computed with the algorithm verifying the file, see fileInfo.checksum
+	failedPrecheck bool   // the file failed the gzip pre-check and it has not been hashed
+	err            error
+}
+
+// matches reports whether the sum is the expected one of fi, never if the file failed the gzip pre-check.
+func (c checksum) matches(fi fileInfo) bool {
+	_, _, expected := fi.checksum()
+	return !c.failedPrecheck && c.sum == expected
+}
+
+// checksums computes the sums of paths, storing ffi, with a bounded pool of workers: the i-th result refers
+// to the i-th path. Files failing the gzip pre-check, if any, are not hashed and are flagged as such,
+// while of files without a sum in the index only the existence is checked.
+func (w Wikidump) checksums(ctx context.Context, ffi []fileInfo, paths []string) ([]checksum, error) {
+	workers := w.verifyWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	sums := make([]checksum, len(paths))
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if !w.passesGzipPrecheck(ffi[j], paths[j]) {
+					sums[j].failedPrecheck = true
+					continue
+				}
+				if !ffi[j].hasChecksum() {
+					_, sums[j].err = os.Stat(paths[j])
+					continue
+				}
+				_, hash, _ := ffi[j].checksum()
+				sums[j].sum, sums[j].err = fileSum(paths[j], hash)
+			}
+		}()
+	}
+
+	err := ctx.Err()
+	for i := 0; i < len(paths) && err == nil; i++ {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Error: change in context state")
+	}
+	return sums, nil
+}
@@ -0,0 +1,138 @@
+package wikidump
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestVerifyMirror(t *testing.T) {
+	root, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	ffi := make([]fileInfo, 0, len(name2MyInfo))
+	for name, info := range name2MyInfo {
+		ffi = append(ffi, fileInfo{URL: "https://dumps.wikimedia.org/enwiki/20200101" + name, SHA1: info.SHA1})
+	}
+	tDump := Wikidump{file2Info: map[string][]fileInfo{"helloword": ffi}}
+
+	dir := filepath.Join(root, "enwiki", "20200101")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	//helloword.gz is valid, helloword.bz2 is corrupted and helloword.7z is missing
+	if err := ioutil.WriteFile(filepath.Join(dir, "helloword.gz"), name2MyInfo["/helloword.gz"].Data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "helloword.bz2"), []byte("corrupted"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := tDump.VerifyMirror(context.Background(), root)
+	if err != nil {
+		t.Fatal("VerifyMirror returns ", err)
+	}
+	expected := Report{
+		Verified: []string{filepath.Join(dir, "helloword.gz")},
+		Missing:  []string{filepath.Join(dir, "helloword.7z")},
+		Corrupt:  []string{filepath.Join(dir, "helloword.bz2")},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("Report should be %+v but it's %+v", expected, report)
+	}
+}
+
+func TestVerifyMirrorSums(t *testing.T) {
+	root, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	data := name2MyInfo["/helloword.gz"].Data
+	for _, name := range []string{"sha256.gz", "md5.gz", "corrupted.gz", "nosum.gz"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//the strongest sum wins over a stale SHA1 sum
+	tDump := Wikidump{file2Info: map[string][]fileInfo{"helloword": {
+		{URL: "https://dumps.wikimedia.org/sha256.gz", SHA1: "stale", SHA256: fmt.Sprintf("%x", sha256.Sum256(data))},
+		{URL: "https://dumps.wikimedia.org/md5.gz", MD5: fmt.Sprintf("%x", md5.Sum(data))},
+		{URL: "https://dumps.wikimedia.org/corrupted.gz", MD5: fmt.Sprintf("%x", md5.Sum([]byte("corrupted")))},
+		{URL: "https://dumps.wikimedia.org/nosum.gz"},
+		{URL: "https://dumps.wikimedia.org/missing.gz"},
+	}}}
+
+	report, err := tDump.VerifyMirror(context.Background(), root)
+	if err != nil {
+		t.Fatal("VerifyMirror returns ", err)
+	}
+	expected := Report{
+		Verified:   []string{filepath.Join(root, "sha256.gz"), filepath.Join(root, "md5.gz")},
+		Unverified: []string{filepath.Join(root, "nosum.gz")},
+		Missing:    []string{filepath.Join(root, "missing.gz")},
+		Corrupt:    []string{filepath.Join(root, "corrupted.gz")},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("Report should be %+v but it's %+v", expected, report)
+	}
+}
+
+func TestVerifyMirrorConcurrently(t *testing.T) {
+	root, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	//every third part is corrupted, every fifth is missing
+	info := name2MyInfo["/helloword.gz"]
+	ffi := []fileInfo{}
+	expected := Report{}
+	for i := 0; i < 30; i++ {
+		name := "helloword" + strconv.Itoa(i) + ".gz"
+		ffi = append(ffi, fileInfo{URL: "https://dumps.wikimedia.org/" + name, SHA1: info.SHA1})
+		localPath := filepath.Join(root, name)
+		data := info.Data
+		switch {
+		case i%5 == 0:
+			expected.Missing = append(expected.Missing, localPath)
+			continue
+		case i%3 == 0:
+			data = []byte("corrupted")
+			expected.Corrupt = append(expected.Corrupt, localPath)
+		default:
+			expected.Verified = append(expected.Verified, localPath)
+		}
+		if err := ioutil.WriteFile(localPath, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tDump, err := Wikidump{file2Info: map[string][]fileInfo{"helloword": ffi}}.With(WithVerifyConcurrency(4))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	report, err := tDump.VerifyMirror(context.Background(), root)
+	if err != nil {
+		t.Fatal("VerifyMirror returns ", err)
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("Report should be %+v but it's %+v", expected, report)
+	}
+
+	if _, err := tDump.With(WithVerifyConcurrency(0)); err == nil {
+		t.Error("WithVerifyConcurrency(0) should return an error")
+	}
+}
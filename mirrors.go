@@ -0,0 +1,144 @@
+package wikidump
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WithMirrors sets mirrors of dumps.wikimedia.org, given by their base URL, to download the resources from.
+// Resources are downloaded from the first mirror, or from the fastest one if WithProbeMirrors is enabled.
+// When a download from a mirror fails after its retries, it fails over to the next mirror and lastly
+// to dumps.wikimedia.org itself, verifying the same checksum; it fails only once all of them have failed.
+func WithMirrors(mirrors ...string) Option {
+	return func(w *Wikidump) error {
+		bases := make([]string, len(mirrors))
+		for i, mirror := range mirrors {
+			if !strings.HasPrefix(mirror, "http://") && !strings.HasPrefix(mirror, "https://") && !strings.HasPrefix(mirror, "file://") {
+				return errors.New("Error: invalid mirror " + mirror)
+			}
+			bases[i] = strings.TrimSuffix(mirror, "/")
+		}
+		w.mirrors = bases
+		w.rankMirrors()
+		return nil
+	}
+}
+
+// WithProbeMirrors sets whether the mirrors are probed with a HEAD request, or a stat of their root if local, and ranked by latency, preferring
+// the fastest one for all the downloads. Mirrors failing the probe or answering with an unsuccessful status are ranked last.
+// The mirrors are probed once, when this option or WithMirrors is applied with both set, so options setting the client
+// should precede them. By default it's disabled.
+func WithProbeMirrors(probe bool) Option {
+	return func(w *Wikidump) error {
+		w.probeMirrors = probe
+		w.rankMirrors()
+		return nil
+	}
+}
+
+// probeTimeout bounds the time spent probing the mirrors.
+const probeTimeout = 10 * time.Second
+
+// origin is the base URL of the dumps that mirrors replace.
+const origin = "https://dumps.wikimedia.org"
+
+// mirrorURL returns the URL of the resource at url on the mirror chosen for failover, if any, or else on the preferred one.
+func (w Wikidump) mirrorURL(url string) string {
+	if len(w.mirrors) == 0 || !strings.HasPrefix(url, origin) {
+		return url
+	}
+	mirror := w.mirror
+	if mirror == "" {
+		mirror = w.rankedMirrors()[0]
+	}
+	return mirror + strings.TrimPrefix(url, origin)
+}
+
+// failover returns the mirrors to download fi from in order, ending with the origin. An empty mirror stands for the preferred one.
+func (w Wikidump) failover(fi fileInfo) []string {
+	if len(w.mirrors) == 0 || !strings.HasPrefix(fi.URL, origin) {
+		return []string{""}
+	}
+	return append(append([]string{}, w.rankedMirrors()...), origin)
+}
+
+// rankedMirrors returns the mirrors from the fastest to the slowest if probing is enabled, as they are set otherwise.
+func (w Wikidump) rankedMirrors() []string {
+	if !w.probeMirrors || w.ranked == nil {
+		return w.mirrors
+	}
+	return w.ranked
+}
+
+// rankMirrors probes the mirrors, if probing is enabled, and stores them from the fastest to the slowest.
+func (w *Wikidump) rankMirrors() {
+	w.ranked = nil
+	if !w.probeMirrors || len(w.mirrors) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	latencies := make([]time.Duration, len(w.mirrors))
+	wg := sync.WaitGroup{}
+	for i, mirror := range w.mirrors {
+		wg.Add(1)
+		go func(i int, mirror string) {
+			defer wg.Done()
+			latencies[i] = w.probe(ctx, mirror)
+		}(i, mirror)
+	}
+	wg.Wait()
+
+	order := make([]int, len(w.mirrors))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return latencies[order[i]] < latencies[order[j]] })
+	w.ranked = make([]string, len(order))
+	for i, j := range order {
+		w.ranked[i] = w.mirrors[j]
+	}
+	w.logf("Mirrors ranked by latency: %v", strings.Join(w.ranked, ", "))
+}
+
+// probe returns the latency of a HEAD request to mirror, unreachable mirrors and the ones answering with
+// an unsuccessful status have the maximum latency. Local mirrors are probed checking that their root exists.
+func (w Wikidump) probe(ctx context.Context, mirror string) time.Duration {
+	const unreachable = time.Duration(1<<63 - 1)
+	if strings.HasPrefix(mirror, "file://") {
+		u, err := url.Parse(mirror + "/")
+		if err != nil {
+			return unreachable
+		}
+		start := time.Now()
+		if info, err := os.Stat(filepath.FromSlash(u.Path)); err != nil || !info.IsDir() {
+			return unreachable
+		}
+		return time.Since(start)
+	}
+	req, err := http.NewRequest(http.MethodHead, mirror+"/", nil)
+	if err != nil {
+		return unreachable
+	}
+	req.Header.Set("User-Agent", w.agent())
+	start := time.Now()
+	resp, err := w.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return unreachable
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return unreachable
+	}
+	return time.Since(start)
+}
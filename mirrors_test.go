@@ -0,0 +1,160 @@
+package wikidump
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProbeMirrors(t *testing.T) {
+	var mu sync.Mutex
+	method2Count := map[string]int{}
+	mirror := func(name string, latency time.Duration) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			method2Count[name+" "+r.Method]++
+			mu.Unlock()
+			time.Sleep(latency)
+			w.Write(name2MyInfo[r.URL.Path].Data)
+		}))
+	}
+	slow, fast := mirror("slow", 100*time.Millisecond), mirror("fast", 0)
+	defer slow.Close()
+	defer fast.Close()
+
+	fi := fileInfo{URL: "https://dumps.wikimedia.org/helloword.gz", SHA1: name2MyInfo["/helloword.gz"].SHA1}
+	tDump, err := Wikidump{file2Info: map[string][]fileInfo{"helloword": {fi}}}.With(WithMirrors(slow.URL, fast.URL), WithProbeMirrors(true))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	for i := 0; i < 2; i++ {
+		r, err := tDump.Open("helloword")(context.Background())
+		if err != nil {
+			t.Fatal("Open returns ", err)
+		}
+		if data, err := ioutil.ReadAll(r); err != nil || string(data) != helloword {
+			t.Error("Reading returns ", string(data), err)
+		}
+		r.Close()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := map[string]int{"slow HEAD": 1, "fast HEAD": 1, "fast GET": 2}
+	for request, count := range expected {
+		if method2Count[request] != count {
+			t.Error(request, "should be requested", count, "times, while it's requested", method2Count[request], "times")
+		}
+	}
+	if method2Count["slow GET"] != 0 {
+		t.Error("The slow mirror should not be used for downloads")
+	}
+}
+
+func TestProbeMirrorsStatus(t *testing.T) {
+	var mu sync.Mutex
+	var probed []string
+	mirror := func(name string, latency time.Duration, status int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			probed = append(probed, name)
+			mu.Unlock()
+			time.Sleep(latency)
+			w.WriteHeader(status)
+		}))
+	}
+	slow, failing := mirror("slow", 50*time.Millisecond, http.StatusOK), mirror("failing", 0, http.StatusServiceUnavailable)
+	defer slow.Close()
+	defer failing.Close()
+
+	tDump, err := Wikidump{}.With(WithMirrors(failing.URL, slow.URL), WithProbeMirrors(true))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	mu.Lock()
+	if len(probed) != 2 {
+		t.Error("The mirrors should be probed once when the options are applied, while the probes are ", probed)
+	}
+	mu.Unlock()
+	if ranked := tDump.rankedMirrors(); len(ranked) != 2 || ranked[0] != slow.URL {
+		t.Error("The mirror failing the probe should be ranked last, while the ranking is ", ranked)
+	}
+}
+
+func TestProbeLocalMirrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "helloword.gz"), name2MyInfo["/helloword.gz"].Data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	local, missing := "file://"+filepath.ToSlash(dir), "file://"+filepath.ToSlash(filepath.Join(dir, "missing"))
+	fi := fileInfo{URL: "https://dumps.wikimedia.org/helloword.gz", SHA1: name2MyInfo["/helloword.gz"].SHA1}
+	tDump, err := Wikidump{file2Info: map[string][]fileInfo{"helloword": {fi}}}.With(WithMirrors(missing, local), WithProbeMirrors(true))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	if ranked := tDump.rankedMirrors(); len(ranked) != 2 || ranked[0] != local {
+		t.Error("The missing local mirror should be ranked last, while the ranking is ", ranked)
+	}
+	r, err := tDump.Open("helloword")(context.Background())
+	if err != nil {
+		t.Fatal("Open returns ", err)
+	}
+	if data, err := ioutil.ReadAll(r); err != nil || string(data) != helloword {
+		t.Error("Reading returns ", string(data), err)
+	}
+	r.Close()
+}
+
+func TestMirrorFailover(t *testing.T) {
+	var mu sync.Mutex
+	name2Count := map[string]int{}
+	mirror := func(name string, handler http.HandlerFunc) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			name2Count[name]++
+			mu.Unlock()
+			handler(w, r)
+		}))
+	}
+	offline := mirror("offline", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusServiceUnavailable) })
+	corrupt := mirror("corrupt", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("corrupt")) })
+	good := mirror("good", func(w http.ResponseWriter, r *http.Request) { w.Write(name2MyInfo[r.URL.Path].Data) })
+	defer offline.Close()
+	defer corrupt.Close()
+	defer good.Close()
+
+	fi := fileInfo{URL: "https://dumps.wikimedia.org/helloword.gz", SHA1: name2MyInfo["/helloword.gz"].SHA1}
+	tDump, err := Wikidump{file2Info: map[string][]fileInfo{"helloword": {fi}}}.With(
+		WithMirrors(offline.URL, corrupt.URL, good.URL), WithRetryPolicy(2, time.Millisecond, time.Millisecond))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	r, err := tDump.Open("helloword")(context.Background())
+	if err != nil {
+		t.Fatal("Open returns ", err)
+	}
+	if data, err := ioutil.ReadAll(r); err != nil || string(data) != helloword {
+		t.Error("Reading returns ", string(data), err)
+	}
+	r.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := map[string]int{"offline": 2, "corrupt": 2, "good": 1}
+	for name, count := range expected {
+		if name2Count[name] != count {
+			t.Error(name, "should be requested", count, "times, while it's requested", name2Count[name], "times")
+		}
+	}
+}
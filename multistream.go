@@ -0,0 +1,425 @@
+package wikidump
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"path"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// OpenMultistream returns a reader over the decompressed content of the multistream bzip2 dump dataName, whose
+// independent streams are decompressed in parallel across the CPU cores and read back in order. The offsets of
+// the streams are taken from the multistream index indexName, whose lines are in the "offset:page id:title" format.
+// Wikimedia ships data and index in the same job, as articlesmultistreamdumprecombine: when dataName and indexName
+// are the same, the index is told apart by its name. Parts of data and index are paired in order.
+// It is the caller's responsibility to call Close on the Reader when done.
+func (w Wikidump) OpenMultistream(ctx context.Context, dataName, indexName string) (io.ReadCloser, error) {
+	if err := w.CheckFor(dataName, indexName); err != nil {
+		return nil, err
+	}
+	data, index := w.file2Info[dataName], w.file2Info[indexName]
+	if dataName == indexName {
+		data, index = splitIndex(data)
+	}
+	if len(data) == 0 || len(data) != len(index) {
+		return nil, errors.Errorf("Error: %v parts of %v don't match %v parts of the index %v", len(data), dataName, len(index), indexName)
+	}
+	for _, fi := range data {
+		if format := formatOf(fi.URL); format != "bzip2" {
+			return nil, errors.Errorf("Error: %v format of the following multistream url: %v", format, fi.URL)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	m := &multistream{ctx: ctx, cancel: cancel, streams: make(chan chan decompressedStream, runtime.NumCPU())}
+	m.running.Add(1)
+	go m.dispatch(w, data, index)
+	if w.filter != nil {
+		return struct {
+			io.Reader
+			io.Closer
+		}{w.filter(m), m}, nil
+	}
+	return m, nil
+}
+
+// splitIndex separates the parts of a multistream job from the parts of its index.
+func splitIndex(ffi []fileInfo) (data, index []fileInfo) {
+	for _, fi := range ffi {
+		if strings.Contains(path.Base(fi.URL), "-index") {
+			index = append(index, fi)
+		} else {
+			data = append(data, fi)
+		}
+	}
+	return
+}
+
+// multistreamOffsets returns the ordered offsets of the streams listed in the index fi, starting with
+// the stream of the header at offset 0.
+func (w Wikidump) multistreamOffsets(ctx context.Context, fi fileInfo) ([]int64, error) {
+	r, err := w.open(ctx, fi)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	offsets := []int64{0}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		offset, err := strconv.ParseInt(strings.SplitN(line, ":", 2)[0], 10, 64)
+		last := offsets[len(offsets)-1]
+		switch {
+		case err != nil || offset < last:
+			return nil, errors.Errorf("Error: invalid line %q in the multistream index downloaded from the following url: %v", line, fi.URL)
+		case offset > last:
+			offsets = append(offsets, offset)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "Error: unable to read the multistream index downloaded from the following url: "+fi.URL)
+	}
+	return offsets, nil
+}
+
+type decompressedStream struct {
+	data []byte
+	err  error
+}
+
+// multistream reads in order the streams decompressed concurrently by dispatch. The capacity of streams bounds
+// the number of streams decompressed ahead of the reader.
+type multistream struct {
+	ctx     context.Context
+	cancel  func()
+	streams chan chan decompressedStream
+	running sync.WaitGroup
+	current []byte
+	err     error
+}
+
+// dispatch stores one part at a time, decompressing its streams concurrently. Each part is closed
+// once all its streams are decompressed.
+func (m *multistream) dispatch(w Wikidump, data, index []fileInfo) {
+	defer m.running.Done()
+	defer close(m.streams)
+	for i, fi := range data {
+		part, err := w.multistreamPart(m.ctx, fi)
+		var offsets []int64
+		if err == nil {
+			if offsets, err = w.multistreamOffsets(m.ctx, index[i]); err != nil {
+				part.Close()
+			}
+		}
+		if err != nil {
+			failed := make(chan decompressedStream, 1)
+			failed <- decompressedStream{err: err}
+			m.send(failed)
+			return
+		}
+
+		var decompressing sync.WaitGroup
+		ra := part.Reader.(io.ReaderAt)
+		for j, start := range offsets {
+			end := int64(math.MaxInt64)
+			if j+1 < len(offsets) {
+				end = offsets[j+1]
+			}
+			stream := make(chan decompressedStream, 1)
+			if !m.send(stream) {
+				break
+			}
+			decompressing.Add(1)
+			go func(start, end int64) {
+				defer decompressing.Done()
+				data, err := ioutil.ReadAll(bzip2.NewReader(io.NewSectionReader(ra, start, end-start)))
+				stream <- decompressedStream{data, errors.Wrapf(err, "Error: unable to decompress the stream at offset %v of the following url: %v", start, fi.URL)}
+			}(start, end)
+		}
+
+		m.running.Add(1)
+		go func() {
+			defer m.running.Done()
+			decompressing.Wait()
+			part.Close()
+		}()
+		if m.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// multistreamPart stores the part fi, which must allow random access to its streams.
+func (w Wikidump) multistreamPart(ctx context.Context, fi fileInfo) (virtualFile, error) {
+	part, err := w.stubbornStore(ctx, fi)
+	if err != nil {
+		return virtualFile{}, err
+	}
+	if _, ok := part.Reader.(io.ReaderAt); !ok {
+		part.Close()
+		return virtualFile{}, errors.New("Error: no random access to the file downloaded from the following url: " + fi.URL)
+	}
+	return part, nil
+}
+
+func (m *multistream) send(stream chan decompressedStream) bool {
+	select {
+	case m.streams <- stream:
+		return true
+	case <-m.ctx.Done():
+		return false
+	}
+}
+
+func (m *multistream) Read(p []byte) (n int, err error) {
+	for len(m.current) == 0 && m.err == nil {
+		stream, ok := <-m.streams
+		if !ok {
+			if m.err = m.ctx.Err(); m.err == nil {
+				m.err = io.EOF
+			}
+			break
+		}
+		s := <-stream
+		m.current, m.err = s.data, s.err
+	}
+	if len(m.current) == 0 {
+		return 0, m.err
+	}
+	n = copy(p, m.current)
+	m.current = m.current[n:]
+	return n, nil
+}
+
+// Close stops the decompression, waiting for the streams in progress before releasing the stored parts.
+func (m *multistream) Close() error {
+	m.cancel()
+	m.running.Wait()
+	m.current = nil
+	if m.err == nil {
+		m.err = errors.New("Error: read on closed reader")
+	}
+	return nil
+}
+
+// multistreamJobs are the jobs of multistream dumps along with their index, in order of preference.
+var multistreamJobs = []string{"articlesmultistreamdumprecombine", "articlesmultistreamdump"}
+
+// ErrPageNotFound is returned by SeekPage when the page isn't in the multistream dump.
+var ErrPageNotFound = errors.New("page not found")
+
+// SeekPage returns a reader over the XML of the page with id pageID, from its <page> to its </page> tag, without
+// downloading the whole dump: the offset of the stream holding the page is looked up in the multistream index, then
+// only that stream is downloaded with a range request and decompressed. The SHA1 sum of a stream can't be checked.
+// The index is downloaded and parsed by the first call, then kept by the wikidump and its copies for the following ones.
+// If the page isn't in the dump, the returned error wraps ErrPageNotFound.
+// It is the caller's responsibility to call Close on the Reader when done.
+func (w Wikidump) SeekPage(ctx context.Context, pageID int64) (io.ReadCloser, error) {
+	job := ""
+	for _, j := range multistreamJobs {
+		if w.CheckFor(j) == nil {
+			job = j
+			break
+		}
+	}
+	if job == "" {
+		return nil, errors.Errorf("Error: no multistream dump, as none of %v is available", strings.Join(multistreamJobs, ", "))
+	}
+	data, index := splitIndex(w.file2Info[job])
+	if len(data) == 0 || len(data) != len(index) {
+		return nil, errors.Errorf("Error: %v parts of %v don't match %v parts of its index", len(data), job, len(index))
+	}
+
+	for i, fi := range index {
+		streams, err := w.pageStreams(ctx, fi)
+		if err != nil {
+			return nil, err
+		}
+		start, end, ok := streams.lookup(pageID)
+		if !ok {
+			continue
+		}
+		stream, err := w.fetchRange(ctx, data[i], start, end)
+		if err != nil {
+			return nil, err
+		}
+		page, err := pageIn(bzip2.NewReader(bytes.NewReader(stream)), pageID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error: stream at offset %v of the following url: %v", start, data[i].URL)
+		}
+		return ioutil.NopCloser(bytes.NewReader(page)), nil
+	}
+	return nil, errors.Wrapf(ErrPageNotFound, "Error: no page %v in the multistream index of %v", pageID, job)
+}
+
+// streamIndex is a parsed multistream index: the sorted page ids, the stream holding each one of them
+// and the offsets of the streams, the last one followed by -1 as its end is unknown.
+type streamIndex struct {
+	ids     []int64
+	streams []int32
+	offsets []int64
+}
+
+func (si *streamIndex) Len() int           { return len(si.ids) }
+func (si *streamIndex) Less(i, j int) bool { return si.ids[i] < si.ids[j] }
+func (si *streamIndex) Swap(i, j int) {
+	si.ids[i], si.ids[j] = si.ids[j], si.ids[i]
+	si.streams[i], si.streams[j] = si.streams[j], si.streams[i]
+}
+
+// lookup returns the bounds [start, end) of the stream holding pageID, end is -1 for the last stream.
+func (si *streamIndex) lookup(pageID int64) (start, end int64, ok bool) {
+	i := sort.Search(len(si.ids), func(i int) bool { return si.ids[i] >= pageID })
+	if i == len(si.ids) || si.ids[i] != pageID {
+		return 0, 0, false
+	}
+	stream := si.streams[i]
+	return si.offsets[stream], si.offsets[stream+1], true
+}
+
+// streamIndexes keeps the parsed multistream indexes by url, a nil *streamIndexes keeps nothing.
+type streamIndexes struct {
+	mu        sync.Mutex
+	url2Index map[string]*streamIndex
+}
+
+func newStreamIndexes() *streamIndexes {
+	return &streamIndexes{url2Index: map[string]*streamIndex{}}
+}
+
+// pageStreams returns the multistream index fi, parsing it only the first time for the wikidump and its copies.
+func (w Wikidump) pageStreams(ctx context.Context, fi fileInfo) (*streamIndex, error) {
+	if w.streamIndexes == nil {
+		return w.parseStreamIndex(ctx, fi)
+	}
+	w.streamIndexes.mu.Lock() //held while parsing, so that the index is downloaded once
+	defer w.streamIndexes.mu.Unlock()
+	if si, ok := w.streamIndexes.url2Index[fi.URL]; ok {
+		return si, nil
+	}
+	si, err := w.parseStreamIndex(ctx, fi)
+	if err != nil {
+		return nil, err
+	}
+	w.streamIndexes.url2Index[fi.URL] = si
+	return si, nil
+}
+
+// parseStreamIndex downloads and parses the multistream index fi.
+func (w Wikidump) parseStreamIndex(ctx context.Context, fi fileInfo) (*streamIndex, error) {
+	r, err := w.open(ctx, fi)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	si := &streamIndex{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, ":", 3)
+		var offset, id int64
+		if offset, err = strconv.ParseInt(fields[0], 10, 64); err == nil && len(fields) == 3 {
+			id, err = strconv.ParseInt(fields[1], 10, 64)
+		}
+		if err != nil || len(fields) != 3 {
+			return nil, errors.Errorf("Error: invalid line %q in the multistream index downloaded from the following url: %v", line, fi.URL)
+		}
+		if len(si.offsets) == 0 || si.offsets[len(si.offsets)-1] != offset {
+			si.offsets = append(si.offsets, offset)
+		}
+		si.ids = append(si.ids, id)
+		si.streams = append(si.streams, int32(len(si.offsets)-1))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "Error: unable to read the multistream index downloaded from the following url: "+fi.URL)
+	}
+	si.offsets = append(si.offsets, -1)
+	sort.Stable(si)
+	return si, nil
+}
+
+// fetchRange downloads the bytes in [start, end) of the resource associated with fi, up to its end if end is -1.
+// If the server doesn't serve ranges, the preceding bytes are downloaded and discarded.
+func (w Wikidump) fetchRange(ctx context.Context, fi fileInfo, start, end int64) (data []byte, err error) {
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%v-", start)}}
+	if end >= 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%v-%v", start, end-1))
+	}
+	err = w.stubbornly(ctx, fi.URL, func() error {
+		r, resp, err := w.streamWith(ctx, fi, header)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		if resp.StatusCode != http.StatusPartialContent {
+			if _, err := io.CopyN(ioutil.Discard, r, start); err != nil {
+				return errors.Wrap(err, "Error: unable to skip to the range of the following url: "+fi.URL)
+			}
+		}
+		var body io.Reader = r
+		if end >= 0 {
+			body = io.LimitReader(r, end-start)
+		}
+		if data, err = ioutil.ReadAll(body); err != nil {
+			return errors.Wrap(err, "Error: unable to download the range of the following url: "+fi.URL)
+		}
+		return nil
+	})
+	return
+}
+
+// pageIn returns the XML of the page with id pageID in r, whose id is the first <id> tag of the page.
+func pageIn(r io.Reader, pageID int64) ([]byte, error) {
+	id := []byte("<id>" + strconv.FormatInt(pageID, 10) + "</id>")
+	var page bytes.Buffer
+	inPage, idSeen, matches := false, false, false
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		trimmed := bytes.TrimSpace(line)
+		if bytes.HasPrefix(trimmed, []byte("<page>")) {
+			page.Reset()
+			inPage, idSeen, matches = true, false, false
+		}
+		if inPage {
+			page.Write(line)
+			if !idSeen && bytes.HasPrefix(trimmed, []byte("<id>")) {
+				idSeen, matches = true, bytes.Equal(trimmed, id)
+			}
+			if bytes.HasSuffix(trimmed, []byte("</page>")) {
+				if matches {
+					return page.Bytes(), nil
+				}
+				inPage = false
+			}
+		}
+
+		switch {
+		case err == io.EOF:
+			return nil, errors.Wrapf(ErrPageNotFound, "no page %v", pageID)
+		case err != nil:
+			return nil, errors.Wrap(err, "unable to decompress")
+		}
+	}
+}
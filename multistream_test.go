@@ -0,0 +1,137 @@
+package wikidump
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// multistreamFixture holds the streams of a multistream dump: the header, two streams of pages and the footer.
+var multistreamFixture = []myInfo{
+	base642MyInfo("QlpoOTFBWSZTWQbgIFcAAADJgAAQAAUmKgCAIAAiAD0hADCY1tAWC8XckU4UJAG4CBXA"),
+	base642MyInfo("QlpoOTFBWSZTWSJ3yQgAAA9fgEAQQACwBQAAhAAmpcSAIABQoGmhkZMQKqnqn6ifqCMPUPhQgwkQUwlVYv3WaUJP6EIUs5LtZCzlw7F+SxIaHnou5IpwoSBE75IQ"),
+	base642MyInfo("QlpoOTFBWSZTWSW8KucAAAfbgEAQQACIBQQAJuRUACAAUKaZGJiYglT0UeoepmU0YgEYcERh4eYZMSkubKHuhfWXdbBNtNJ+LuSKcKEgS3hVzg=="),
+	base642MyInfo("QlpoOTFBWSZTWe2+c6oAAAFZgAAQAACABSYqAIAgACIGhpoIBppoAksUl1rvF3JFOFCQ7b5zqg=="),
+}
+
+const (
+	pageOne   = "  <page>\n    <title>One</title>\n    <id>1</id>\n  </page>\n"
+	pageTwo   = "  <page>\n    <title>Two</title>\n    <id>2</id>\n  </page>\n"
+	pageThree = "  <page>\n    <title>Three</title>\n    <id>3</id>\n  </page>\n"
+)
+
+const multistreamContent = "<mediawiki>\n" + pageOne + pageTwo + pageThree + "</mediawiki>\n"
+
+// multistreamDump returns the data of a multistream dump along with its index.
+func multistreamDump() (data, index []byte) {
+	var b bytes.Buffer
+	var offsets []int
+	for _, stream := range multistreamFixture {
+		offsets = append(offsets, b.Len())
+		b.Write(stream.Data)
+	}
+	return b.Bytes(), []byte(fmt.Sprintf("%v:1:One\n%v:2:Two\n%v:3:Three\n", offsets[1], offsets[1], offsets[2]))
+}
+
+func TestOpenMultistream(t *testing.T) {
+	data, index := multistreamDump()
+	name2Info := map[string]myInfo{
+		"/pages-articles-multistream.xml.bz2":       {data, sha1Of(data)},
+		"/pages-articles-multistream-index.txt":     {index, sha1Of(index)},
+		"/pages-articles-multistream-bad-index.txt": {[]byte("1:1:One\n"), sha1Of([]byte("1:1:One\n"))},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(name2Info[r.URL.Path].Data)
+	}))
+	defer server.Close()
+	fi := func(name string) fileInfo {
+		return fileInfo{URL: server.URL + name, SHA1: name2Info[name].SHA1}
+	}
+
+	tDump := Wikidump{file2Info: map[string][]fileInfo{
+		"multistream": {fi("/pages-articles-multistream-index.txt"), fi("/pages-articles-multistream.xml.bz2")},
+		"badindex":    {fi("/pages-articles-multistream-bad-index.txt")},
+		"data":        {fi("/pages-articles-multistream.xml.bz2")},
+	}}
+	r, err := tDump.OpenMultistream(context.Background(), "multistream", "multistream")
+	if err != nil {
+		t.Fatal("OpenMultistream returns ", err)
+	}
+	if content, err := ioutil.ReadAll(r); err != nil || string(content) != multistreamContent {
+		t.Errorf("Reading returns %q %v", content, err)
+	}
+	if err := r.Close(); err != nil {
+		t.Error("Closing returns ", err)
+	}
+
+	//an offset inside a stream is reported
+	r, err = tDump.OpenMultistream(context.Background(), "data", "badindex")
+	if err != nil {
+		t.Fatal("OpenMultistream returns ", err)
+	}
+	if _, err := ioutil.ReadAll(r); err == nil || !strings.Contains(err.Error(), "unable to decompress the stream") {
+		t.Error("Reading with a wrong index should fail, while it returns ", err)
+	}
+	r.Close()
+
+	//parts of data and index should match
+	if _, err := tDump.OpenMultistream(context.Background(), "data", "multistream"); err == nil {
+		t.Error("OpenMultistream should report unmatched parts")
+	}
+}
+
+func TestSeekPage(t *testing.T) {
+	data, index := multistreamDump()
+	var ranges []string
+	indexRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content := index
+		if strings.HasSuffix(r.URL.Path, ".xml.bz2") {
+			content, ranges = data, append(ranges, r.Header.Get("Range"))
+		} else {
+			indexRequests++
+		}
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	tDump := Wikidump{file2Info: map[string][]fileInfo{"articlesmultistreamdumprecombine": {
+		{URL: server.URL + "/pages-articles-multistream-index.txt", SHA1: sha1Of(index)},
+		{URL: server.URL + "/pages-articles-multistream.xml.bz2", SHA1: sha1Of(data)},
+	}}, streamIndexes: newStreamIndexes()}
+	start, end := len(multistreamFixture[0].Data), len(multistreamFixture[0].Data)+len(multistreamFixture[1].Data)
+	for pageID, expected := range map[int64]string{1: pageOne, 2: pageTwo, 3: pageThree} {
+		ranges = nil
+		r, err := tDump.SeekPage(context.Background(), pageID)
+		if err != nil {
+			t.Fatal("SeekPage returns ", err)
+		}
+		if page, err := ioutil.ReadAll(r); err != nil || string(page) != expected {
+			t.Errorf("Page %v is %q %v", pageID, page, err)
+		}
+		r.Close()
+		if pageID < 3 && !reflect.DeepEqual(ranges, []string{fmt.Sprintf("bytes=%v-%v", start, end-1)}) {
+			t.Error("SeekPage should download only the stream of the page, while it requests ", ranges)
+		}
+	}
+
+	if _, err := tDump.SeekPage(context.Background(), 4); !errors.Is(err, ErrPageNotFound) {
+		t.Error("SeekPage should return ErrPageNotFound, while it returns ", err)
+	}
+	if indexRequests != 1 {
+		t.Error("The index should be downloaded once, while it's downloaded", indexRequests, "times")
+	}
+}
+
+func sha1Of(data []byte) string {
+	return fmt.Sprintf("%x", sha1.Sum(data))
+}
@@ -1,65 +1,384 @@
 package wikidump
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"net/http"
+	"path"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 )
 
-// Latest creates a new wikidump from the latest valid wikipedia dump.
+// Dumps makes the requests of the dump indexes of the wikidumps it creates with Client and UserAgent, which are also
+// the ones of their downloads unless they set WithHTTPClient and WithUserAgent. If Client is nil http.DefaultClient is used,
+// if UserAgent is empty the package UserAgent is used. The functions of the package creating wikidumps use the zero Dumps.
+type Dumps struct {
+	Client    *http.Client
+	UserAgent string
+}
+
+// Latest creates a new wikidump from the latest valid wikipedia dump, as Dumps.Latest does.
 func Latest(tmpDir, lang string, checkFor ...string) (w Wikidump, err error) {
-	dates, err := dumpDates(lang)
+	return Dumps{}.Latest(tmpDir, lang, checkFor...)
+}
+
+// Latest creates a new wikidump from the latest valid wikipedia dump, that is the latest one with all the files of checkFor.
+// Its temporary files are created in tmpDir, or in os.TempDir() if empty, which is checked to be writable.
+// If no dump has them, the returned error wraps ErrDateNotFound.
+func (d Dumps) Latest(tmpDir, lang string, checkFor ...string) (w Wikidump, err error) {
+	return d.latest(context.Background(), tmpDir, lang, checkFor...)
+}
+
+// latest is Latest, with the index requests stopped by ctx.
+func (d Dumps) latest(ctx context.Context, tmpDir, lang string, checkFor ...string) (w Wikidump, err error) {
+	if err = checkTmpDir(tmpDir); err != nil {
+		return Wikidump{}, err
+	}
+	dates, err := d.AvailableDates(ctx, lang)
 	if err != nil {
 		return
 	}
 
-	for i := len(dates) - 1; i >= 0; i-- {
-		w, err = From(tmpDir, lang, dates[i])
-		if err == nil && w.CheckFor(checkFor...) == nil {
+	for i := len(dates) - 1; i >= 0 && ctx.Err() == nil; i-- {
+		var data dumpStatus
+		if data, err = d.fetchDumpStatus(ctx, lang, dates[i]); err != nil {
+			continue
+		}
+		if w = d.newWikidump(tmpDir, lang, dates[i], data); w.CheckFor(checkFor...) == nil {
 			return
 		}
 	}
+	switch {
+	case ctx.Err() != nil:
+		err = ctx.Err()
+	case err == nil:
+		err = errors.Wrapf(ErrDateNotFound, "Error: no %v dump with %v", lang, strings.Join(checkFor, ", "))
+	}
 	w = Wikidump{}
 	return
 }
 
-// From creates a new wikidump from the specified date.
+// LangErrors collects the errors of LatestMulti by language.
+type LangErrors map[string]error
+
+func (errs LangErrors) Error() string {
+	langs := make([]string, 0, len(errs))
+	for lang := range errs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+
+	messages := make([]string, len(langs))
+	for i, lang := range langs {
+		messages[i] = lang + ": " + errs[lang].Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// MaxConcurrentLatest is the maximum number of languages whose indexes LatestMulti requests at the same time,
+// it bounds the load of the index requests on the server of the dumps, that throttles clients opening many connections.
+const MaxConcurrentLatest = 4
+
+// LatestMulti creates concurrently a new wikidump from the latest valid wikipedia dump of each language,
+// as Dumps.LatestMulti does.
+func LatestMulti(ctx context.Context, tmpDir string, langs ...string) (map[string]*Wikidump, error) {
+	return Dumps{}.LatestMulti(ctx, tmpDir, langs...)
+}
+
+// LatestMulti creates concurrently a new wikidump from the latest valid wikipedia dump of each language,
+// up to MaxConcurrentLatest at a time. The wikidumps successfully created are returned even if some languages fail,
+// in which case the error is a LangErrors. The context stops also the index requests in progress.
+func (d Dumps) LatestMulti(ctx context.Context, tmpDir string, langs ...string) (map[string]*Wikidump, error) {
+	lang2Dump := make(map[string]*Wikidump, len(langs))
+	errs := LangErrors{}
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	slots := make(chan struct{}, MaxConcurrentLatest)
+	for _, lang := range langs {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			errs[lang] = errors.Wrap(ctx.Err(), "Error: change in context state")
+			continue
+		}
+
+		wg.Add(1)
+		go func(lang string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			w, err := d.latest(ctx, tmpDir, lang)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[lang] = err
+				return
+			}
+			lang2Dump[lang] = &w
+		}(lang)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return lang2Dump, errs
+	}
+	return lang2Dump, nil
+}
+
+// From creates a new wikidump from the specified date, as Dumps.From does.
 func From(tmpDir, lang string, t time.Time) (w Wikidump, err error) {
-	fail := func(e error) (Wikidump, error) {
-		w, err = Wikidump{}, e
-		return w, err
+	return Dumps{}.From(tmpDir, lang, t)
+}
+
+// From creates a new wikidump from the specified date, with its temporary files in tmpDir as in Latest.
+func (d Dumps) From(tmpDir, lang string, t time.Time) (w Wikidump, err error) {
+	if err = checkTmpDir(tmpDir); err != nil {
+		return Wikidump{}, err
+	}
+	data, err := d.fetchDumpStatus(context.Background(), lang, t)
+	if err != nil {
+		return Wikidump{}, err
 	}
+	return d.newWikidump(tmpDir, lang, t, data), nil
+}
+
+// ErrDateNotFound is returned by At when there's no dump of the requested date, and by Latest when no dump has the requested files.
+var ErrDateNotFound = errors.New("dump date not found")
+
+// maxNearbyDates is the maximum number of available dates on each side of the requested one reported by At.
+const maxNearbyDates = 2
 
-	indexURL := fmt.Sprintf("https://dumps.wikimedia.org/%vwiki/%v/dumpstatus.json", strings.Replace(lang, "-", "_", -1), t.Format("20060102"))
-	resp, err := http.Get(indexURL)
+// At creates a new wikidump from the dump of the specified date, as Dumps.At does.
+func At(ctx context.Context, tmpDir, lang string, date time.Time) (Wikidump, error) {
+	return Dumps{}.At(ctx, tmpDir, lang, date)
+}
+
+// At creates a new wikidump from the dump of the specified date, checking that it's among the available ones.
+// If it's not, the returned error wraps ErrDateNotFound and lists the closest available dates.
+func (d Dumps) At(ctx context.Context, tmpDir, lang string, date time.Time) (Wikidump, error) {
+	if err := checkTmpDir(tmpDir); err != nil {
+		return Wikidump{}, err
+	}
+	dates, err := d.AvailableDates(ctx, lang)
 	if err != nil {
-		return fail(errors.Wrap(err, "Error: unable to get page: "+indexURL))
+		return Wikidump{}, err
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	day := date.Format("20060102")
+	i := sort.Search(len(dates), func(i int) bool { return dates[i].Format("20060102") >= day })
+	if i == len(dates) || dates[i].Format("20060102") != day {
+		from, to := i-maxNearbyDates, i+maxNearbyDates
+		if from < 0 {
+			from = 0
+		}
+		if to > len(dates) {
+			to = len(dates)
+		}
+		nearby := make([]string, 0, to-from)
+		for _, t := range dates[from:to] {
+			nearby = append(nearby, t.Format("20060102"))
+		}
+		return Wikidump{}, errors.Wrapf(ErrDateNotFound, "Error: no %v dump of %v, the nearest available dates are %v", lang, day, strings.Join(nearby, ", "))
+	}
+
+	data, err := d.fetchDumpStatus(ctx, lang, dates[i])
 	if err != nil {
-		return fail(errors.Wrap(err, "Error: unable to read all the page: "+indexURL))
+		return Wikidump{}, err
+	}
+	return d.newWikidump(tmpDir, lang, dates[i], data), nil
+}
+
+// WaitForComplete waits for the dump of the specified date to be complete and creates it, as Dumps.WaitForComplete does.
+func WaitForComplete(ctx context.Context, tmpDir, lang string, t time.Time, poll time.Duration) (*Wikidump, error) {
+	return Dumps{}.WaitForComplete(ctx, tmpDir, lang, t, poll)
+}
+
+// WaitForComplete polls the status of the dump of the specified date, starting every poll and slowing down
+// up to maxPollFactor times as much, until no job is waiting or in progress. Then it creates the wikidump.
+// Errors while polling, such as a dump not started yet, are retried until the context is done. It fails if poll isn't positive.
+func (d Dumps) WaitForComplete(ctx context.Context, tmpDir, lang string, t time.Time, poll time.Duration) (*Wikidump, error) {
+	if poll <= 0 {
+		return nil, errors.Errorf("Error: invalid poll interval %v", poll)
 	}
+	if err := checkTmpDir(tmpDir); err != nil {
+		return nil, err
+	}
+	maxPoll := poll * maxPollFactor
+	for {
+		data, err := d.fetchDumpStatus(ctx, lang, t)
+		if err == nil && data.complete() {
+			w := d.newWikidump(tmpDir, lang, t, data)
+			return &w, nil
+		}
 
-	var data struct {
-		Jobs map[string]struct {
-			Status string
-			Files  map[string]fileInfo
+		select {
+		case <-time.After(poll):
+		case <-ctx.Done():
+			if err == nil {
+				err = errors.New("the dump is not complete")
+			}
+			return nil, errors.Wrapf(ctx.Err(), "Error: change in context state while waiting for the dump (last status: %v)", err)
 		}
+		if poll *= 2; poll > maxPoll {
+			poll = maxPoll
+		}
+	}
+}
+
+// maxPollFactor bounds the slowdown of WaitForComplete.
+const maxPollFactor = 16
+
+func (d Dumps) fetchDumpStatus(ctx context.Context, lang string, t time.Time) (data dumpStatus, err error) {
+	indexURL := fmt.Sprintf("%v/%vwiki/%v/dumpstatus.json", dumpsURL, strings.Replace(lang, "-", "_", -1), t.Format("20060102"))
+	body, err := d.fetchPage(ctx, indexURL)
+	if err != nil {
+		return dumpStatus{}, err
+	}
+
+	data, err = parseDumpStatus(body)
+	if err != nil {
+		return dumpStatus{}, errors.Wrap(err, "Error: unable to Unmarshal the JSON in the page: "+indexURL)
+	}
+	return data, nil
+}
+
+// FromFS creates a new wikidump of the specified date from an index stored in fsys, as Dumps.FromFS does.
+func FromFS(tmpDir, lang string, fsys fs.FS, name string, t time.Time) (w Wikidump, err error) {
+	return Dumps{}.FromFS(tmpDir, lang, fsys, name, t)
+}
+
+// FromFS creates a new wikidump of the specified date from the dumpstatus.json index stored in fsys under name.
+func (d Dumps) FromFS(tmpDir, lang string, fsys fs.FS, name string, t time.Time) (w Wikidump, err error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return Wikidump{}, errors.Wrap(err, "Error: unable to open the index: "+name)
+	}
+	defer f.Close()
+
+	return d.FromIndex(tmpDir, lang, f, t)
+}
+
+// FromIndex creates a new wikidump of the specified date from an index, as Dumps.FromIndex does.
+func FromIndex(tmpDir, lang string, r io.Reader, t time.Time) (w Wikidump, err error) {
+	return Dumps{}.FromIndex(tmpDir, lang, r, t)
+}
+
+// FromIndex creates a new wikidump of the specified date from a dumpstatus.json index, such as the ones from ExportStatus.
+// The index may be gzipped.
+func (d Dumps) FromIndex(tmpDir, lang string, r io.Reader, t time.Time) (w Wikidump, err error) {
+	if err = checkTmpDir(tmpDir); err != nil {
+		return Wikidump{}, err
 	}
-	if err := json.Unmarshal(body, &data); err != nil {
-		return fail(errors.Wrap(err, "Error: unable to Unmarshal the JSON in the page: "+indexURL))
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Wikidump{}, errors.Wrap(err, "Error: unable to read the index")
 	}
+
+	data, err := parseDumpStatus(body)
+	if err != nil {
+		return Wikidump{}, errors.Wrap(err, "Error: unable to Unmarshal the JSON in the index")
+	}
+	return d.newWikidump(tmpDir, lang, t, data), nil
+}
+
+func (d Dumps) newWikidump(tmpDir, lang string, t time.Time, data dumpStatus) (w Wikidump) {
+	w = newWikidump(tmpDir, lang, t, data)
+	w.httpClient, w.userAgent = d.Client, d.UserAgent
+	return
+}
+
+func newWikidump(tmpDir, lang string, t time.Time, data dumpStatus) (w Wikidump) {
 	w.date = t
+	w.lang = lang
 	w.tmpDir = tmpDir
-	w.file2Info = make(map[string][]fileInfo, len(data.Jobs))
+	w.file2Info = data.file2Info()
+	w.job2Status = make(map[string]string, len(data.Jobs))
+	for job, status := range data.Jobs {
+		w.job2Status[job] = status.Status
+	}
+	w.reportedSize = data.Size
+	w.progress = newDownloadProgress()
+	w.materialized = newMaterialized()
+	w.jitter = newJitter(time.Now().UnixNano())
+	w.stats = newStats()
+	w.streamIndexes = newStreamIndexes()
+	return
+}
+
+// ExportStatus serializes the index of the wikidump in the dumpstatus.json format, that FromIndex is able to parse.
+// The jobs keep their status, the ones of the files without a status in the index are exported as done.
+func (w Wikidump) ExportStatus() ([]byte, error) {
+	data := dumpStatus{Jobs: make(map[string]jobStatus, len(w.job2Status)), Size: w.reportedSize}
+	for job, status := range w.job2Status {
+		data.Jobs[job] = jobStatus{status, map[string]fileInfo{}}
+	}
+	for file, ffi := range w.file2Info {
+		files := make(map[string]fileInfo, len(ffi))
+		for _, fi := range ffi {
+			name := path.Base(fi.URL)
+			fi.URL = strings.TrimPrefix(fi.URL, "https://dumps.wikimedia.org")
+			files[name] = fi
+		}
+		status, ok := w.job2Status[file]
+		if !ok {
+			status = "done"
+		}
+		data.Jobs[file] = jobStatus{status, files}
+	}
+	body, err := json.Marshal(data)
+	return body, errors.Wrap(err, "Error: unable to Marshal the index")
+}
+
+type dumpStatus struct {
+	Jobs map[string]jobStatus `json:"jobs"`
+	Size int64                `json:"size,omitempty"` //optional aggregate size of all the files
+}
+
+type jobStatus struct {
+	Status string              `json:"status"`
+	Files  map[string]fileInfo `json:"files"`
+}
+
+// complete reports whether the run is over, that is no job is waiting or in progress.
+func (data dumpStatus) complete() bool {
+	for _, job := range data.Jobs {
+		if job.Status == "waiting" || job.Status == "in-progress" {
+			return false
+		}
+	}
+	return len(data.Jobs) > 0
+}
+
+// parseDumpStatus parses a dumpstatus.json index, transparently decompressing it if it's gzipped.
+func parseDumpStatus(body []byte) (data dumpStatus, err error) {
+	if sniffExt(bufio.NewReader(bytes.NewReader(body))) == ".gz" {
+		r, err := unGZip(virtualFile{bytes.NewReader(body), func() error { return nil }, "dumpstatus.json.gz"})
+		if err != nil {
+			return dumpStatus{}, errors.Wrap(err, "Error: unable to decompress the index")
+		}
+		defer r.Close()
+		if body, err = ioutil.ReadAll(r); err != nil {
+			return dumpStatus{}, errors.Wrap(err, "Error: unable to decompress the index")
+		}
+	}
+	err = json.Unmarshal(body, &data)
+	return
+}
+
+// file2Info returns the files of the completed jobs, with their parts in natural order.
+func (data dumpStatus) file2Info() (file2Info map[string][]fileInfo) {
+	file2Info = make(map[string][]fileInfo, len(data.Jobs))
 	for file, statusFiles := range data.Jobs {
 		if statusFiles.Status != "done" || len(statusFiles.Files) == 0 {
 			continue
@@ -67,30 +386,72 @@ func From(tmpDir, lang string, t time.Time) (w Wikidump, err error) {
 
 		infos := make([]fileInfo, 0, len(statusFiles.Files))
 		for _, fi := range statusFiles.Files {
-			fi.URL = "https://dumps.wikimedia.org" + fi.URL
+			if strings.HasPrefix(fi.URL, "/") {
+				fi.URL = "https://dumps.wikimedia.org" + fi.URL
+			}
 			infos = append(infos, fi)
 		}
-		w.file2Info[file] = infos
+		sort.Slice(infos, func(i, j int) bool { return naturalLess(infos[i].URL, infos[j].URL) })
+		file2Info[file] = infos
 	}
 	return
 }
 
-func dumpDates(lang string) (dates []time.Time, err error) {
+// naturalLess compares strings treating runs of digits as numbers, so that parts are ordered as 1, 2, ..., 10.
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := digitsPrefix(a), digitsPrefix(b)
+		switch {
+		case da != "" && db != "":
+			na, nb := strings.TrimLeft(da, "0"), strings.TrimLeft(db, "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[len(da):], b[len(db):]
+		case a[0] != b[0]:
+			return a[0] < b[0]
+		default:
+			a, b = a[1:], b[1:]
+		}
+	}
+	return len(a) < len(b)
+}
+
+func digitsPrefix(s string) string {
+	i := 0
+	for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
+
+// dumpsURL is the root of the dumps indexes, it's a variable so that tests can replace it.
+var dumpsURL = "https://dumps.wikimedia.org"
+
+// AvailableDates returns the sorted dates of the dumps of lang, as Dumps.AvailableDates does.
+func AvailableDates(ctx context.Context, lang string) (dates []time.Time, err error) {
+	return Dumps{}.AvailableDates(ctx, lang)
+}
+
+// AvailableDates returns the sorted dates of the dumps of lang listed in the dumps index, including the ones in progress.
+// They can be passed to At, or to WaitForComplete to find the most recent complete dump.
+func (d Dumps) AvailableDates(ctx context.Context, lang string) (dates []time.Time, err error) {
+	return d.listDates(ctx, fmt.Sprintf("%v/%vwiki/", dumpsURL, strings.Replace(lang, "-", "_", -1)), lang)
+}
+
+// listDates returns the sorted dates of the dumps of lang listed in the page at indexURL.
+func (d Dumps) listDates(ctx context.Context, indexURL, lang string) (dates []time.Time, err error) {
 	fail := func(e error) ([]time.Time, error) {
 		dates, err = nil, e
 		return nil, e
 	}
 	nameExp := regexp.MustCompile(`<a href="(\d+)/">[^\n]+\n`)
-	indexURL := fmt.Sprintf("https://dumps.wikimedia.org/%vwiki/", strings.Replace(lang, "-", "_", -1))
-	resp, err := http.Get(indexURL)
-	if err != nil {
-		return fail(errors.Wrap(err, "Error: unable to get page: "+indexURL))
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
+	body, err := d.fetchPage(ctx, indexURL)
 	if err != nil {
-		return fail(errors.Wrap(err, "Error: unable to read all the page: "+indexURL))
+		return fail(err)
 	}
 	bodyString := string(body)
 
@@ -105,5 +466,37 @@ func dumpDates(lang string) (dates []time.Time, err error) {
 	if len(dates) == 0 {
 		err = errors.New("No dump dates with " + lang + " dump")
 	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
 	return
 }
+
+// fetchPage returns the content of the page at pageURL, failing on unsuccessful responses.
+func (d Dumps) fetchPage(ctx context.Context, pageURL string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error: unable to create the request for page: "+pageURL)
+	}
+	userAgent := d.UserAgent
+	if userAgent == "" {
+		userAgent = UserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error: unable to get page: "+pageURL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, errors.Errorf("Error: unable to get page: %v: %v", pageURL, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error: unable to read all the page: "+pageURL)
+	}
+	return body, nil
+}
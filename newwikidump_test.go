@@ -0,0 +1,724 @@
+package wikidump
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+const dumpStatusFixture = `{"jobs": {
+	"articlesdump": {"status": "done", "files": {
+		"enwiki-20200101-pages-articles10.xml-p5p6.bz2": {"url": "/enwiki/20200101/enwiki-20200101-pages-articles10.xml-p5p6.bz2", "sha1": "c"},
+		"enwiki-20200101-pages-articles1.xml-p1p2.bz2": {"url": "/enwiki/20200101/enwiki-20200101-pages-articles1.xml-p1p2.bz2", "sha1": "a"},
+		"enwiki-20200101-pages-articles2.xml-p3p4.bz2": {"url": "/enwiki/20200101/enwiki-20200101-pages-articles2.xml-p3p4.bz2", "sha1": "b"}
+	}},
+	"usergroupstable": {"status": "done", "files": {
+		"enwiki-20200101-user_groups.sql.gz": {"url": "/enwiki/20200101/enwiki-20200101-user_groups.sql.gz", "sha1": "d"}
+	}},
+	"articlesmultistreamdumprecombine": {"status": "done", "files": {
+		"enwiki-20200101-pages-articles-multistream.xml.bz2": {"url": "/enwiki/20200101/enwiki-20200101-pages-articles-multistream.xml.bz2", "sha1": "e"},
+		"enwiki-20200101-pages-articles-multistream-index.txt.bz2": {"url": "/enwiki/20200101/enwiki-20200101-pages-articles-multistream-index.txt.bz2", "sha1": "f"}
+	}},
+	"metahistory7zdump": {"status": "done", "files": {
+		"enwiki-20200101-pages-meta-history1.xml-p1p2.7z": {"url": "/enwiki/20200101/enwiki-20200101-pages-meta-history1.xml-p1p2.7z", "sha1": "g"}
+	}},
+	"sitestatstable": {"status": "done", "files": {
+		"enwiki-20200101-site_stats.txt": {"url": "/enwiki/20200101/enwiki-20200101-site_stats.txt", "sha1": "h"}
+	}},
+	"metahistorybz2dump": {"status": "in-progress", "files": {}}
+}}`
+
+func TestURLs(t *testing.T) {
+	data, err := parseDumpStatus([]byte(dumpStatusFixture))
+	if err != nil {
+		t.Fatal("parseDumpStatus returns ", err)
+	}
+	file2Info := data.file2Info()
+	tDump := Wikidump{file2Info: file2Info}
+
+	urls, err := tDump.URLs("articlesdump")
+	if err != nil {
+		t.Fatal("URLs returns ", err)
+	}
+	expected := []string{
+		"https://dumps.wikimedia.org/enwiki/20200101/enwiki-20200101-pages-articles1.xml-p1p2.bz2",
+		"https://dumps.wikimedia.org/enwiki/20200101/enwiki-20200101-pages-articles2.xml-p3p4.bz2",
+		"https://dumps.wikimedia.org/enwiki/20200101/enwiki-20200101-pages-articles10.xml-p5p6.bz2",
+	}
+	if !reflect.DeepEqual(urls, expected) {
+		t.Error("URLs should be", expected, "but they're", urls)
+	}
+
+	if _, err := tDump.URLs("metahistorybz2dump"); !errors.Is(err, ErrFileNotFound) {
+		t.Error("URLs should return ErrFileNotFound, while it returns ", err)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	data, err := parseDumpStatus([]byte(dumpStatusFixture))
+	if err != nil {
+		t.Fatal("parseDumpStatus returns ", err)
+	}
+	tDump := Wikidump{file2Info: data.file2Info()}
+
+	infos, err := tDump.Info("articlesdump")
+	if err != nil {
+		t.Fatal("Info returns ", err)
+	}
+	urls, _ := tDump.URLs("articlesdump")
+	if len(infos) != len(urls) {
+		t.Fatal("Info should describe", len(urls), "resources, while it describes", len(infos))
+	}
+	for i, sha1 := range []string{"a", "b", "c"} {
+		if infos[i] != (FileInfo{URL: urls[i], SHA1: sha1}) {
+			t.Error("Invalid description of", urls[i], ":", infos[i])
+		}
+	}
+	if _, err := tDump.Info("metahistorybz2dump"); !errors.Is(err, ErrFileNotFound) {
+		t.Error("Info should return ErrFileNotFound, while it returns ", err)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	tDump, err := Wikidump{file2Info: map[string][]fileInfo{"articlesdump": {
+		{URL: "https://dumps.wikimedia.org/enwiki/20200101/enwiki-20200101-pages-articles1.xml-p1p2.bz2", SHA1: "a", Size: 1},
+		{URL: "https://dumps.wikimedia.org/enwiki/20200101/enwiki-20200101-pages-articles2.xml-p3p4.bz2", SHA1: "b", Size: 2},
+	}}}.With(WithMirrors("https://mirror.example/wikimedia/"))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+
+	plan, err := tDump.Plan("articlesdump")
+	if err != nil {
+		t.Fatal("Plan returns ", err)
+	}
+	expected := []FileInfo{
+		{URL: "https://mirror.example/wikimedia/enwiki/20200101/enwiki-20200101-pages-articles1.xml-p1p2.bz2", SHA1: "a", Size: 1},
+		{URL: "https://mirror.example/wikimedia/enwiki/20200101/enwiki-20200101-pages-articles2.xml-p3p4.bz2", SHA1: "b", Size: 2},
+	}
+	if !reflect.DeepEqual(plan, expected) {
+		t.Error("Plan returns", plan, "instead of", expected)
+	}
+	if _, err := tDump.Plan("metahistorybz2dump"); !errors.Is(err, ErrFileNotFound) {
+		t.Error("Plan should return ErrFileNotFound, while it returns ", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	data, err := parseDumpStatus([]byte(dumpStatusFixture))
+	if err != nil {
+		t.Fatal("parseDumpStatus returns ", err)
+	}
+	tDump := newWikidump("", "en", time.Time{}, data)
+
+	for filename, expected := range map[string]string{"articlesdump": "done", "metahistorybz2dump": "in-progress"} {
+		if status, err := tDump.Status(filename); err != nil || status != expected {
+			t.Error("The status of", filename, "should be", expected, "while Status returns", status, err)
+		}
+	}
+	if _, err := tDump.Status("missing"); !errors.Is(err, ErrFileNotFound) {
+		t.Error("Status should return ErrFileNotFound, while it returns ", err)
+	}
+
+	err = tDump.CheckComplete()
+	if !errors.Is(err, ErrIncompleteDump) || !strings.Contains(err.Error(), "metahistorybz2dump (in-progress)") {
+		t.Error("CheckComplete should report the job in progress, while it returns ", err)
+	}
+	data.Jobs["metahistorybz2dump"] = jobStatus{"done", data.Jobs["articlesdump"].Files}
+	if err := newWikidump("", "en", time.Time{}, data).CheckComplete(); err != nil {
+		t.Error("CheckComplete returns ", err)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	data, err := parseDumpStatus([]byte(dumpStatusFixture))
+	if err != nil {
+		t.Fatal("parseDumpStatus returns ", err)
+	}
+	tDump := Wikidump{file2Info: data.file2Info()}
+
+	expected := []string{"articlesdump", "articlesmultistreamdumprecombine", "metahistory7zdump", "sitestatstable", "usergroupstable"}
+	files := tDump.Files()
+	if !reflect.DeepEqual(files, expected) {
+		t.Error("Files should be", expected, "but they're", files)
+	}
+	for _, filename := range files {
+		if err := tDump.CheckFor(filename); err != nil {
+			t.Error("CheckFor returns ", err)
+		}
+	}
+	if files := (Wikidump{}).Files(); len(files) != 0 {
+		t.Error("An empty wikidump should have no files, while it has ", files)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	data, err := parseDumpStatus([]byte(dumpStatusFixture))
+	if err != nil {
+		t.Fatal("parseDumpStatus returns ", err)
+	}
+	tDump := Wikidump{file2Info: data.file2Info()}
+
+	for pattern, expected := range map[string][]string{
+		"articles*":               {"articlesdump", "articlesmultistreamdumprecombine"},
+		"nothing*":                nil,
+		"*table":                  {"sitestatstable", "usergroupstable"},
+		"*pages-articles[0-9]*":   {"articlesdump"},
+		"*pages-articles*":        {"articlesdump", "articlesmultistreamdumprecombine"},
+		"articlesmultistream*":    {"articlesmultistreamdumprecombine"},
+		"enwiki-*-pages-meta-*7z": {"metahistory7zdump"},
+	} {
+		if matched, err := tDump.Match(pattern); err != nil || !reflect.DeepEqual(matched, expected) {
+			t.Error("Match of", pattern, "should return", expected, "while it returns", matched, err)
+		}
+	}
+	if _, err := tDump.Match("["); err == nil {
+		t.Error("Match should reject an invalid pattern")
+	}
+}
+
+func TestExpectedSHA1(t *testing.T) {
+	data, err := parseDumpStatus([]byte(dumpStatusFixture))
+	if err != nil {
+		t.Fatal("parseDumpStatus returns ", err)
+	}
+	tDump := Wikidump{file2Info: data.file2Info()}
+
+	sums := tDump.ExpectedSHA1s()
+	for file, job := range data.Jobs {
+		if job.Status != "done" {
+			continue
+		}
+		for name, fi := range job.Files {
+			if sums[name] != fi.SHA1 {
+				t.Error("The SHA1 of", name, "should be", fi.SHA1, "but it's", sums[name], "in", file)
+			}
+		}
+	}
+	if len(sums) != 8 {
+		t.Error("ExpectedSHA1s should return 8 sums, while it returns ", len(sums))
+	}
+
+	for file, ffi := range tDump.file2Info {
+		sha1, err := tDump.ExpectedSHA1(file)
+		switch {
+		case len(ffi) > 1 && err == nil:
+			t.Error("ExpectedSHA1 should fail for", file, "made of", len(ffi), "resources")
+		case len(ffi) == 1 && (err != nil || sha1 != ffi[0].SHA1):
+			t.Error("ExpectedSHA1 of", file, "returns ", sha1, err)
+		}
+	}
+
+	if _, err := tDump.ExpectedSHA1("missing"); !errors.Is(err, ErrFileNotFound) {
+		t.Error("ExpectedSHA1 should return ErrFileNotFound, while it returns ", err)
+	}
+}
+
+func TestEstimateDecompressedSize(t *testing.T) {
+	index := `{"jobs": {
+	"articlesdump": {"status": "done", "files": {
+		"enwiki-20200101-pages-articles1.xml-p1p2.bz2": {"url": "/enwiki/20200101/enwiki-20200101-pages-articles1.xml-p1p2.bz2", "sha1": "a", "size": 100, "uncompressed_size": 700},
+		"enwiki-20200101-pages-articles2.xml-p3p4.bz2": {"url": "/enwiki/20200101/enwiki-20200101-pages-articles2.xml-p3p4.bz2", "sha1": "b", "size": 100, "uncompressed_size": 500}
+	}},
+	"usergroupstable": {"status": "done", "files": {
+		"enwiki-20200101-user_groups.sql.gz": {"url": "/enwiki/20200101/enwiki-20200101-user_groups.sql.gz", "sha1": "d", "size": 10}
+	}},
+	"sitestatstable": {"status": "done", "files": {
+		"enwiki-20200101-site_stats.txt": {"url": "/enwiki/20200101/enwiki-20200101-site_stats.txt", "sha1": "h"}
+	}}
+}}`
+	tDump, err := FromIndex("", "en", strings.NewReader(index), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal("FromIndex returns ", err)
+	}
+
+	for filename, expected := range map[string]struct {
+		size  int64
+		exact bool
+	}{"articlesdump": {1200, true}, "usergroupstable": {10 * format2Ratio["gzip"], false}} {
+		if size, exact, err := tDump.EstimateDecompressedSize(filename); err != nil || size != expected.size || exact != expected.exact {
+			t.Error("The decompressed size of", filename, "should be", expected.size, "exact", expected.exact, "but it's", size, exact, err)
+		}
+	}
+	if _, _, err := tDump.EstimateDecompressedSize("sitestatstable"); err == nil {
+		t.Error("Error should be not null")
+	}
+	if _, _, err := tDump.EstimateDecompressedSize("missing"); !errors.Is(err, ErrFileNotFound) {
+		t.Error("EstimateDecompressedSize should return ErrFileNotFound, while it returns ", err)
+	}
+}
+
+func TestTmpDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	missing := filepath.Join(dir, "missing")
+
+	if _, err := FromIndex(missing, "en", strings.NewReader(dumpStatusFixture), time.Now()); err == nil {
+		t.Error("FromIndex should reject a missing temporary directory")
+	}
+	tDump, err := FromIndex("", "en", strings.NewReader(dumpStatusFixture), time.Now())
+	if err != nil {
+		t.Fatal("FromIndex returns ", err)
+	}
+	if _, err := tDump.With(WithTmpDir(missing, false)); err == nil {
+		t.Error("WithTmpDir should reject a missing directory")
+	}
+	if tDump, err = tDump.With(WithTmpDir(missing, true)); err != nil || tDump.tmpDir != missing {
+		t.Error("WithTmpDir should create the directory, while it returns ", err)
+	}
+	if infos, err := ioutil.ReadDir(missing); err != nil || len(infos) != 0 {
+		t.Error("The check should leave the directory empty, while there are ", len(infos), err)
+	}
+}
+
+func TestFromFS(t *testing.T) {
+	fsys := fstest.MapFS{"enwiki/20200101/dumpstatus.json": &fstest.MapFile{Data: []byte(dumpStatusFixture)}}
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tDump, err := FromFS("", "en", fsys, "enwiki/20200101/dumpstatus.json", date)
+	if err != nil {
+		t.Fatal("FromFS returns ", err)
+	}
+
+	if !tDump.Date().Equal(date) {
+		t.Error("Date should be", date, "but it's", tDump.Date())
+	}
+	if err := tDump.CheckFor("articlesdump", "usergroupstable"); err != nil {
+		t.Error("CheckFor returns ", err)
+	}
+	if err := tDump.CheckFor("metahistorybz2dump"); !errors.Is(err, ErrFileNotFound) {
+		t.Error("CheckFor should return ErrFileNotFound, while it returns ", err)
+	}
+
+	if _, err := FromFS("", "en", fsys, "missing.json", date); err == nil {
+		t.Error("Error should be not null")
+	}
+
+	//the index may be gzipped
+	fsys["enwiki/20200101/dumpstatus.json.gz"] = &fstest.MapFile{Data: gzipMyInfo(dumpStatusFixture).Data}
+	gzDump, err := FromFS("", "en", fsys, "enwiki/20200101/dumpstatus.json.gz", date)
+	if err != nil {
+		t.Fatal("FromFS returns ", err)
+	}
+	if !reflect.DeepEqual(gzDump.file2Info, tDump.file2Info) {
+		t.Errorf("The gzipped index should be parsed as %+v, while it's parsed as %+v", tDump.file2Info, gzDump.file2Info)
+	}
+}
+
+func TestSameRun(t *testing.T) {
+	fsys := fstest.MapFS{"dumpstatus.json": &fstest.MapFile{Data: []byte(dumpStatusFixture)}}
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	w0, err := FromFS("", "en", fsys, "dumpstatus.json", date)
+	if err != nil {
+		t.Fatal("FromFS returns ", err)
+	}
+	w1, err := FromFS("/tmp", "en", fsys, "dumpstatus.json", date)
+	if err != nil {
+		t.Fatal("FromFS returns ", err)
+	}
+	if !w0.SameRun(&w1) {
+		t.Error("Wikidumps from the same index should refer to the same run")
+	}
+
+	w1.file2Info["usergroupstable"][0].SHA1 = "e"
+	if w0.SameRun(&w1) {
+		t.Error("Wikidumps with different checksums should not refer to the same run")
+	}
+
+	w2, err := FromFS("", "it", fsys, "dumpstatus.json", date)
+	if err != nil {
+		t.Fatal("FromFS returns ", err)
+	}
+	if w0.SameRun(&w2) || w0.SameRun(nil) {
+		t.Error("Wikidumps of different wikis should not refer to the same run")
+	}
+}
+
+func TestFormats(t *testing.T) {
+	data, err := parseDumpStatus([]byte(dumpStatusFixture))
+	if err != nil {
+		t.Fatal("parseDumpStatus returns ", err)
+	}
+	file2Info := data.file2Info()
+	formats := Wikidump{file2Info: file2Info}.Formats()
+	expected := map[string]int{"bzip2": 5, "gzip": 1, "7z": 1, "none": 1}
+	if !reflect.DeepEqual(formats, expected) {
+		t.Error("Formats should be", expected, "but they're", formats)
+	}
+}
+
+func TestExportStatus(t *testing.T) {
+	data, err := parseDumpStatus([]byte(dumpStatusFixture))
+	if err != nil {
+		t.Fatal("parseDumpStatus returns ", err)
+	}
+	file2Info := data.file2Info()
+	file2Info["mirrored"] = []fileInfo{{URL: "https://mirror.example.org/enwiki/20200101/mirrored.gz", SHA1: "i", Size: 42}}
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	job2Status := map[string]string{}
+	for job, status := range data.Jobs {
+		job2Status[job] = status.Status
+	}
+	w0 := Wikidump{file2Info: file2Info, job2Status: job2Status, lang: "en", date: date}
+
+	body, err := w0.ExportStatus()
+	if err != nil {
+		t.Fatal("ExportStatus returns ", err)
+	}
+	w1, err := FromIndex("", "en", bytes.NewReader(body), date)
+	if err != nil {
+		t.Fatal("FromIndex returns ", err)
+	}
+	if !reflect.DeepEqual(w0.file2Info, w1.file2Info) {
+		t.Errorf("Index should be %+v but it's %+v", w0.file2Info, w1.file2Info)
+	}
+	job2Status["mirrored"] = "done"
+	if !reflect.DeepEqual(job2Status, w1.job2Status) {
+		t.Errorf("Job statuses should be %v but they're %v", job2Status, w1.job2Status)
+	}
+	if status, err := w1.Status("metahistorybz2dump"); err != nil || status != "in-progress" {
+		t.Error("The job in progress should keep its status, while Status returns ", status, err)
+	}
+	if err := w1.CheckComplete(); !errors.Is(err, ErrIncompleteDump) {
+		t.Error("CheckComplete should report the job in progress, while it returns ", err)
+	}
+}
+
+func TestTotalSize(t *testing.T) {
+	w := Wikidump{file2Info: map[string][]fileInfo{
+		"articlesdump":    {{URL: "/a1.bz2", SHA1: "a", Size: 100}, {URL: "/a2.bz2", SHA1: "b"}},
+		"usergroupstable": {{URL: "/ug.sql.gz", SHA1: "c", Size: 10}},
+	}}
+	if size, err := w.TotalSize("articlesdump", "usergroupstable"); size != 110 || !errors.Is(err, ErrUnknownSize) || !strings.Contains(err.Error(), "/a2.bz2") {
+		t.Error("TotalSize should report the known sizes and the unknown ones, while it returns ", size, err)
+	}
+	if size, err := w.TotalSize("usergroupstable"); err != nil || size != 10 {
+		t.Error("TotalSize should be 10 but it's", size, err)
+	}
+	if _, err := w.TotalSize("nothing"); !errors.Is(err, ErrFileNotFound) {
+		t.Error("TotalSize should reject unknown filenames, while it returns ", err)
+	}
+}
+
+func TestVerifyTotalSize(t *testing.T) {
+	w := Wikidump{file2Info: map[string][]fileInfo{
+		"articlesdump":    {{URL: "/a1.bz2", SHA1: "a", Size: 100}, {URL: "/a2.bz2", SHA1: "b", Size: 200}},
+		"usergroupstable": {{URL: "/ug.sql.gz", SHA1: "c", Size: 10}},
+	}}
+	if size := w.TotalDumpSize(); size != 310 {
+		t.Error("TotalDumpSize should be 310 but it's", size)
+	}
+
+	w.reportedSize = 310
+	if err := w.VerifyTotalSize(); err != nil {
+		t.Error("VerifyTotalSize returns ", err)
+	}
+
+	w.reportedSize = 1310
+	if err := w.VerifyTotalSize(); err == nil || !strings.Contains(err.Error(), "1310") {
+		t.Error("VerifyTotalSize should report the mismatch, while it returns ", err)
+	}
+
+	body := `{"jobs": {"articlesdump": {"status": "done", "files": {"a1.bz2": {"url": "/a1.bz2", "sha1": "a", "size": 100}}}}, "size": 300}`
+	w, err := FromIndex("", "en", strings.NewReader(body), time.Now())
+	if err != nil {
+		t.Fatal("FromIndex returns ", err)
+	}
+	if err := w.VerifyTotalSize(); err == nil {
+		t.Error("Error should be not null")
+	}
+}
+
+func TestLatestMissingFile(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/enwiki/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<a href=\"20200101/\">20200101/</a>\n"))
+	})
+	mux.HandleFunc("/enwiki/20200101/dumpstatus.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(dumpStatusFixture))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	defer func(old string) { dumpsURL = old }(dumpsURL)
+	dumpsURL = server.URL
+
+	if _, err := Latest("", "en", "articlesdump"); err != nil {
+		t.Error("Latest returns ", err)
+	}
+	if _, err := Latest("", "en", "missing"); !errors.Is(err, ErrDateNotFound) {
+		t.Error("Latest should return ErrDateNotFound, while it returns ", err)
+	}
+}
+
+func TestLatestMulti(t *testing.T) {
+	mux := http.NewServeMux()
+	for _, lang := range []string{"en", "it", "de"} {
+		mux.HandleFunc("/"+lang+"wiki/", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("<a href=\"20200101/\">20200101/</a>\n"))
+		})
+		mux.HandleFunc("/"+lang+"wiki/20200101/dumpstatus.json", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(dumpStatusFixture))
+		})
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	defer func(old string) { dumpsURL = old }(dumpsURL)
+	dumpsURL = server.URL
+
+	lang2Dump, err := LatestMulti(context.Background(), "", "en", "it", "xx", "de", "yy")
+	var errs LangErrors
+	if !errors.As(err, &errs) {
+		t.Fatal("LatestMulti should return LangErrors, while it returns ", err)
+	}
+	if len(errs) != 2 || errs["xx"] == nil || errs["yy"] == nil {
+		t.Error("LatestMulti should fail only for xx and yy, while it returns ", errs)
+	}
+	if len(lang2Dump) != 3 {
+		t.Error("LatestMulti should create 3 wikidumps, while it creates ", len(lang2Dump))
+	}
+	for _, lang := range []string{"en", "it", "de"} {
+		w := lang2Dump[lang]
+		if w == nil || w.lang != lang || w.CheckFor("articlesdump") != nil {
+			t.Error("Invalid wikidump for ", lang, ": ", w)
+		}
+	}
+}
+
+func TestLatestMultiCancel(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/enwiki/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<a href=\"20200101/\">20200101/</a>\n"))
+	})
+	mux.HandleFunc("/enwiki/20200101/dumpstatus.json", func(w http.ResponseWriter, r *http.Request) {
+		select { //the index hangs until the request is cancelled
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	defer func(old string) { dumpsURL = old }(dumpsURL)
+	dumpsURL = server.URL
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := LatestMulti(ctx, "", "en"); err == nil {
+		t.Error("LatestMulti should fail once the context is done")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Error("LatestMulti should stop the index requests in progress, while it takes ", elapsed)
+	}
+}
+
+func TestIndexUserAgent(t *testing.T) {
+	var mu sync.Mutex
+	var agents []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/enwiki/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		agents = append(agents, r.Header.Get("User-Agent"))
+		mu.Unlock()
+		w.Write([]byte("<a href=\"20200101/\">20200101/</a>\n"))
+	})
+	mux.HandleFunc("/enwiki/20200101/dumpstatus.json", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		agents = append(agents, r.Header.Get("User-Agent"))
+		mu.Unlock()
+		w.Write([]byte(dumpStatusFixture))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	defer func(old string) { dumpsURL = old }(dumpsURL)
+	dumpsURL = server.URL
+
+	for _, dumps := range []Dumps{{}, {UserAgent: "negapedia/2.0 (contact@example.org)"}} {
+		expected := dumps.UserAgent
+		if expected == "" {
+			expected = UserAgent
+		}
+		mu.Lock()
+		agents = nil
+		mu.Unlock()
+		tDump, err := dumps.Latest("", "en")
+		if err != nil {
+			t.Fatal("Latest returns ", err)
+		}
+		if tDump.agent() != expected {
+			t.Errorf("The downloads should have User-Agent %q, while they have %q", expected, tDump.agent())
+		}
+		mu.Lock()
+		if len(agents) < 2 {
+			t.Error("Latest should request the list of dumps and the dump status, while it requests ", len(agents), " pages")
+		}
+		for _, agent := range agents {
+			if agent != expected {
+				t.Errorf("The index request should have User-Agent %q, while it has %q", expected, agent)
+			}
+		}
+		mu.Unlock()
+	}
+}
+
+func TestIndexClient(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/enwiki/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<a href=\"20200101/\">20200101/</a>\n"))
+	})
+	mux.HandleFunc("/enwiki/20200101/dumpstatus.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(dumpStatusFixture))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	defer func(old string) { dumpsURL = old }(dumpsURL)
+	dumpsURL = server.URL
+
+	var mu sync.Mutex
+	var trace []string
+	client := &http.Client{Transport: recordingRoundTripper{http.DefaultTransport, &mu, &trace, "client"}}
+	tDump, err := Dumps{Client: client}.Latest("", "en")
+	if err != nil {
+		t.Fatal("Latest returns ", err)
+	}
+	expected := []string{"client /enwiki/", "client /enwiki/20200101/dumpstatus.json"}
+	if !reflect.DeepEqual(trace, expected) {
+		t.Error("The index requests should be made as", expected, "while they're made as", trace)
+	}
+	if tDump.client() != client {
+		t.Error("The downloads should use the client of the Dumps")
+	}
+}
+
+func TestAvailableDates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/itwiki/" {
+			w.Write([]byte("<html>No dumps</html>"))
+			return
+		}
+		w.Write([]byte("<a href=\"../\">../</a>\n<a href=\"20200201/\">20200201/</a>\n<a href=\"20200101/\">20200101/</a>\n<a href=\"latest/\">latest/</a>\n"))
+	}))
+	defer server.Close()
+	defer func(old string) { dumpsURL = old }(dumpsURL)
+	dumpsURL = server.URL
+
+	dates, err := AvailableDates(context.Background(), "it")
+	if err != nil {
+		t.Fatal("AvailableDates returns ", err)
+	}
+	expected := []time.Time{time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)}
+	if !reflect.DeepEqual(dates, expected) {
+		t.Error("AvailableDates should return", expected, "but it returns", dates)
+	}
+	if _, err := AvailableDates(context.Background(), "xx"); err == nil {
+		t.Error("AvailableDates should fail without dumps")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := AvailableDates(ctx, "it"); !errors.Is(err, context.Canceled) {
+		t.Error("AvailableDates should return context.Canceled, while it returns ", err)
+	}
+}
+
+func TestAt(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/enwiki/", func(w http.ResponseWriter, r *http.Request) {
+		for _, date := range []string{"20200301", "20200101", "20200201", "20200401"} {
+			fmt.Fprintf(w, "<a href=\"%v/\">%v/</a>\n", date, date)
+		}
+	})
+	mux.HandleFunc("/enwiki/20200201/dumpstatus.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(dumpStatusFixture))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	defer func(old string) { dumpsURL = old }(dumpsURL)
+	dumpsURL = server.URL
+
+	date := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	w, err := At(context.Background(), "", "en", date)
+	if err != nil {
+		t.Fatal("At returns ", err)
+	}
+	if !w.Date().Equal(date) || w.CheckFor("articlesdump") != nil {
+		t.Error("Invalid wikidump: ", w)
+	}
+
+	_, err = At(context.Background(), "", "en", time.Date(2020, 2, 15, 0, 0, 0, 0, time.UTC))
+	if !errors.Is(err, ErrDateNotFound) {
+		t.Fatal("At should return ErrDateNotFound, while it returns ", err)
+	}
+	for _, nearby := range []string{"20200101", "20200201", "20200301", "20200401"} {
+		if !strings.Contains(err.Error(), nearby) {
+			t.Error("The error should list the nearby date ", nearby, ", while it's ", err)
+		}
+	}
+}
+
+func TestWaitForComplete(t *testing.T) {
+	var mu sync.Mutex
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch polls++; {
+		case polls == 1 || strings.HasPrefix(r.URL.Path, "/itwiki/"):
+			http.NotFound(w, r)
+		case polls < 4:
+			w.Write([]byte(dumpStatusFixture))
+		default:
+			w.Write([]byte(strings.Replace(dumpStatusFixture, `"in-progress"`, `"done"`, 1)))
+		}
+	}))
+	defer server.Close()
+	defer func(old string) { dumpsURL = old }(dumpsURL)
+	dumpsURL = server.URL
+
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	w, err := WaitForComplete(context.Background(), "", "en", date, time.Millisecond)
+	if err != nil {
+		t.Fatal("WaitForComplete returns ", err)
+	}
+	if polls != 4 {
+		t.Error("WaitForComplete should poll 4 times, while it polls", polls, "times")
+	}
+	if err := w.CheckFor("articlesdump", "usergroupstable"); err != nil {
+		t.Error("CheckFor returns ", err)
+	}
+
+	//the dump of itwiki never starts
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := WaitForComplete(ctx, "", "it", date, time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("WaitForComplete should stop when the context is done, while it returns ", err)
+	}
+
+	//polls without an interval are rejected before any request
+	mu.Lock()
+	polls = 0
+	mu.Unlock()
+	for _, poll := range []time.Duration{0, -time.Second} {
+		if _, err := WaitForComplete(context.Background(), "", "en", date, poll); err == nil {
+			t.Error("WaitForComplete should reject the poll interval ", poll)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if polls != 0 {
+		t.Error("WaitForComplete should not poll with an invalid interval, while it polls", polls, "times")
+	}
+}
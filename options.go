@@ -0,0 +1,388 @@
+package wikidump
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Logger receives the diagnostic messages of a Wikidump, it's satisfied by *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+func (w Wikidump) logf(format string, v ...interface{}) {
+	if w.logger != nil {
+		w.logger.Printf(format, v...)
+	}
+}
+
+// Option configures the behaviour of a Wikidump.
+type Option func(*Wikidump) error
+
+// With returns a copy of the wikidump configured with the specified options.
+func (w Wikidump) With(options ...Option) (Wikidump, error) {
+	for _, option := range options {
+		if err := option(&w); err != nil {
+			return Wikidump{}, err
+		}
+	}
+	return w, nil
+}
+
+// WithTmpDir sets the directory of the temporary files of the downloads in place of the one passed to the constructor,
+// an empty dir stands for os.TempDir() as by default. If create is set, a missing directory is created.
+// It fails if temporary files can't be created in the directory, rather than on the first download.
+func WithTmpDir(dir string, create bool) Option {
+	return func(w *Wikidump) error {
+		if create && dir != "" {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return errors.Wrap(err, "Error: unable to create the temporary directory "+dir)
+			}
+		}
+		if err := checkTmpDir(dir); err != nil {
+			return err
+		}
+		w.tmpDir = dir
+		return nil
+	}
+}
+
+// WithDedicatedTmpDir sets whether a directory of the wikidump is created inside the temporary directory, where its temporary files
+// are created, so that Close can reclaim them all by removing it. Options setting the temporary directory should precede it.
+// Disabling it removes the directory created by a previous WithDedicatedTmpDir, that must still be empty,
+// going back to the temporary directory containing it. By default it's disabled.
+func WithDedicatedTmpDir(enabled bool) Option {
+	return func(w *Wikidump) error {
+		if !enabled {
+			if w.ownedTmpDir == "" {
+				return nil
+			}
+			if err := os.Remove(w.ownedTmpDir); err != nil {
+				return errors.Wrap(err, "Error: unable to remove the following directory: "+w.ownedTmpDir)
+			}
+			if w.tmpDir == w.ownedTmpDir {
+				w.tmpDir = filepath.Dir(w.ownedTmpDir)
+			}
+			w.ownedTmpDir = ""
+			return nil
+		}
+		if w.ownedTmpDir != "" {
+			return nil
+		}
+		dir, err := ioutil.TempDir(w.tmpDir, "wikidump")
+		if err != nil {
+			return errors.Wrap(err, "Error: unable to create a temporary directory in "+w.tmpDir)
+		}
+		w.tmpDir, w.ownedTmpDir = dir, dir
+		return nil
+	}
+}
+
+// Close removes the temporary files of the resources still open and the directory created by WithDedicatedTmpDir,
+// if any, with all its content. It must not be called while readers or iterators of the wikidump are in use,
+// and afterwards downloads can't be stored in the removed directory. Calling it again has no effect.
+func (w Wikidump) Close() error {
+	for _, path := range w.materialized.paths() {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "Error: unable to remove the following file: "+path)
+		}
+	}
+	if w.ownedTmpDir == "" {
+		return nil
+	}
+	return errors.Wrap(os.RemoveAll(w.ownedTmpDir), "Error: unable to remove the following directory: "+w.ownedTmpDir)
+}
+
+// checkTmpDir checks that temporary files can be created in dir, or in os.TempDir() if dir is empty.
+func checkTmpDir(dir string) error {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	f, err := ioutil.TempFile(dir, "wikidump-check")
+	if err != nil {
+		return errors.Wrap(err, "Error: unable to create temporary files in "+dir)
+	}
+	f.Close()
+	return errors.Wrap(os.Remove(f.Name()), "Error: unable to remove temporary files in "+dir)
+}
+
+// WithScanBuffer sets the maximum size of a token returned by the scanners of OpenScanner,
+// by default it's bufio.MaxScanTokenSize.
+func WithScanBuffer(max int) Option {
+	return func(w *Wikidump) error {
+		if max <= 0 {
+			return errors.Errorf("Error: invalid scan buffer size %v", max)
+		}
+		w.scanBuffer = max
+		return nil
+	}
+}
+
+// WithShuffledParts sets whether the resources of a multi-part file are downloaded in random order,
+// spreading the load across the backends of mirrors that shard by path. Resources are still returned in logical order
+// by Open, so all of them are stored in the temporary directory before the first one is returned. By default it's disabled.
+func WithShuffledParts(enabled bool) Option {
+	return func(w *Wikidump) error {
+		w.shuffleParts = enabled
+		return nil
+	}
+}
+
+// WithLogger sets the logger that receives the diagnostic messages, by default they're discarded.
+// Messages report each download attempt, the retries with their wait, checksum mismatches, decompressions
+// and the bytes of completed downloads; the ones starting with "Warning:" report something going wrong.
+func WithLogger(logger Logger) Option {
+	return func(w *Wikidump) error {
+		w.logger = logger
+		return nil
+	}
+}
+
+// WithSniffing sets whether the compression format of a file is detected from its magic bytes.
+// When the detected format contradicts the file extension a warning is logged and the detected format is used,
+// see WithStrictSniffing to fail instead. By default it's disabled.
+func WithSniffing(enabled bool) Option {
+	return func(w *Wikidump) error {
+		w.sniffing = enabled
+		if !enabled {
+			w.strictSniffing = false
+		}
+		return nil
+	}
+}
+
+// WithStrictSniffing sets whether opening a file whose detected compression format contradicts its extension
+// fails with ErrFormatMismatch. Enabling it enables WithSniffing too. By default it's disabled.
+func WithStrictSniffing(strict bool) Option {
+	return func(w *Wikidump) error {
+		w.strictSniffing = strict
+		if strict {
+			w.sniffing = true
+		}
+		return nil
+	}
+}
+
+// WithSpillThreshold sets the size in bytes up to which a resource is buffered in memory instead of being stored
+// in the temporary directory. It applies only to resources whose size is reported by the index and
+// never to 7z archives, as their extraction needs a file. By default all resources are stored in the temporary directory.
+func WithSpillThreshold(size int64) Option {
+	return func(w *Wikidump) error {
+		if size < 0 {
+			return errors.Errorf("Error: invalid spill threshold %v", size)
+		}
+		w.spillThreshold = size
+		return nil
+	}
+}
+
+// WithBeforeAttempt sets a hook called before each download attempt of url, attempts are numbered from 1.
+// If the hook returns an error the download of that file is aborted, this allows for custom pacing and circuit breaking.
+func WithBeforeAttempt(hook func(ctx context.Context, url string, attempt int) error) Option {
+	return func(w *Wikidump) error {
+		w.beforeAttempt = hook
+		return nil
+	}
+}
+
+// WithIdleTimeout sets the maximum time a download attempt can go without receiving any byte,
+// once elapsed the attempt fails with ErrIdleTimeout and it's retried. By default there's no idle timeout.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(w *Wikidump) error {
+		if timeout < 0 {
+			return errors.Errorf("Error: invalid idle timeout %v", timeout)
+		}
+		w.idleTimeout = timeout
+		return nil
+	}
+}
+
+// WithHeadersFor sets a function computing, at request time, the headers to add to the request of each url.
+// This allows for mirrors requiring per-file tokens or signatures.
+func WithHeadersFor(headersFor func(url string) http.Header) Option {
+	return func(w *Wikidump) error {
+		w.headersFor = headersFor
+		return nil
+	}
+}
+
+// WithMemoryBudget bounds the total size in bytes of the resources buffered in memory at the same time,
+// see WithSpillThreshold. When the budget is exhausted, new buffering waits until memory is released by closing
+// the opened files; resources larger than the whole budget are stored in the temporary directory.
+// The budget is shared by all the copies of the wikidump. By default the memory is unbounded.
+func WithMemoryBudget(size int64) Option {
+	return func(w *Wikidump) error {
+		if size <= 0 {
+			return errors.Errorf("Error: invalid memory budget %v", size)
+		}
+		w.memory = newMemoryBudget(size)
+		return nil
+	}
+}
+
+// WithRateLimit bounds the bytes per second received by the downloads, the limit is shared by the concurrent
+// downloads of all the copies of the wikidump, rather than applied to each connection. By default it's unlimited.
+func WithRateLimit(bytesPerSec int64) Option {
+	return func(w *Wikidump) error {
+		if bytesPerSec <= 0 {
+			return errors.Errorf("Error: invalid rate limit %v", bytesPerSec)
+		}
+		w.rateLimiter = newRateLimiter(bytesPerSec)
+		return nil
+	}
+}
+
+// WithCache sets a persistent cache directory, distinct from the temporary one, where verified downloads are kept
+// under their SHA1 sum. Cached files survive Close and are used instead of downloading them again,
+// files listed under different names with the same SHA1 sum are downloaded once. Open reads the decompressed content
+// from the cached file, so a single download serves both, and a file enters the cache only once its SHA1 sum is verified.
+// Downloads are moved to the cache from the temporary directory, copying them when it's on another filesystem:
+// a temporary directory inside dir avoids the copy and makes the moves atomic. Files without a SHA1 sum are cached
+// under their url along with their ETag and Last-Modified headers, and downloaded again only if the server
+// doesn't report them as not modified.
+func WithCache(dir string) Option {
+	return func(w *Wikidump) error {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return errors.Wrap(err, "Error: unable to create the cache directory "+dir)
+		}
+		w.cacheDir = dir
+		return nil
+	}
+}
+
+// WithShouldRetry sets the predicate deciding whether a download is retried after its attempt-th attempt failed with err.
+// It overrides the default classification, that retries all errors except the permanent ones such as ErrHostNotFound.
+func WithShouldRetry(shouldRetry func(err error, attempt int) bool) Option {
+	return func(w *Wikidump) error {
+		w.shouldRetry = shouldRetry
+		return nil
+	}
+}
+
+// WithRetryPolicy sets how many times a download is attempted at most, and the delay between two attempts:
+// it's drawn at random up to a bound starting at initialDelay and doubling after each attempt, up to maxDelay. A Retry-After requested by the server
+// takes the place of the delay. By default downloads are attempted up to 12 times, with delays starting at one second.
+func WithRetryPolicy(maxAttempts int, initialDelay, maxDelay time.Duration) Option {
+	return func(w *Wikidump) error {
+		if maxAttempts <= 0 || initialDelay < 0 || maxDelay < initialDelay {
+			return errors.Errorf("Error: invalid retry policy of %v attempts with delays from %v to %v", maxAttempts, initialDelay, maxDelay)
+		}
+		w.retryPolicy = retryPolicy{maxAttempts, initialDelay, maxDelay}
+		return nil
+	}
+}
+
+// WithTrafficLog sets whether each request is logged with its method, url, response status and received bytes,
+// bodies, credentials and query parameters are never logged. By default it's disabled.
+func WithTrafficLog(enabled bool) Option {
+	return func(w *Wikidump) error {
+		w.trafficLog = enabled
+		return nil
+	}
+}
+
+// WithVerifyOnDisk sets whether each resource stored in the temporary directory is read back and verified again,
+// catching corruption introduced while writing it, at the cost of a second read. Resources found in the cache are
+// verified as well before being opened. By default it's disabled.
+func WithVerifyOnDisk(enabled bool) Option {
+	return func(w *Wikidump) error {
+		w.verifyOnDisk = enabled
+		return nil
+	}
+}
+
+// WithVerifyConcurrency sets the maximum number of files whose SHA1 sum is computed concurrently by VerifyMirror
+// and RepairCache, by default it's the number of CPUs.
+func WithVerifyConcurrency(n int) Option {
+	return func(w *Wikidump) error {
+		if n <= 0 {
+			return errors.Errorf("Error: invalid verify concurrency %v", n)
+		}
+		w.verifyWorkers = n
+		return nil
+	}
+}
+
+// WithRoundTrippers stacks middlewares over the transport used for the downloads, the one of their client
+// (see WithHTTPClient) or http.DefaultTransport if it's nil: the first middleware wraps the transport,
+// the second one wraps the first one and so on. Calling it again stacks further middlewares over the ones already set.
+func WithRoundTrippers(middlewares ...func(http.RoundTripper) http.RoundTripper) Option {
+	return func(w *Wikidump) error {
+		w.roundTrippers = append(append([]func(http.RoundTripper) http.RoundTripper{}, w.roundTrippers...), middlewares...)
+		w.stackRoundTrippers()
+		return nil
+	}
+}
+
+// WithHTTPClient sets the client of the downloads, so that its timeouts, proxy, connection pooling and TLS settings apply.
+// By default it's the client of the Dumps that created the wikidump, see Dumps.
+func WithHTTPClient(client *http.Client) Option {
+	return func(w *Wikidump) error {
+		if client == nil {
+			return errors.New("Error: invalid nil HTTP client")
+		}
+		w.httpClient = client
+		w.stackRoundTrippers()
+		return nil
+	}
+}
+
+// WithFetch replaces the HTTP requests of the downloads with fetch, which returns the content of url along with its headers,
+// so that any transport can be used, such as signed URLs or in-process fixtures, while keeping retries, SHA1 verification
+// and decompression. Headers, User-Agent, mirrors, round trippers and segments apply only to the built-in HTTP requests.
+// By default the resources are fetched with HTTP.
+func WithFetch(fetch func(ctx context.Context, url string) (io.ReadCloser, http.Header, error)) Option {
+	return func(w *Wikidump) error {
+		w.fetcher = fetch
+		return nil
+	}
+}
+
+// WithFilter sets a transformation applied to the decompressed content of each resource, such as a charset conversion.
+// Errors returned by the reads of the filter are returned by the readers of the wikidump.
+func WithFilter(filter func(io.Reader) io.Reader) Option {
+	return func(w *Wikidump) error {
+		w.filter = filter
+		return nil
+	}
+}
+
+// UserAgent identifies the requests of the package, as the Wikimedia User-Agent policy requires a contactable one.
+// It's the default User-Agent of the requests of the dump indexes and of the downloads, see Dumps.
+const UserAgent = "wikidump/1.0 (+https://github.com/ebonetti/wikidump)"
+
+// WithUserAgent sets the User-Agent of the downloads, so that it can carry a contact address of the downstream user.
+// A User-Agent set by WithHeadersFor takes precedence. By default it's the one of the Dumps that created the wikidump:
+// set Dumps.UserAgent so that the requests of the dump indexes carry it too.
+func WithUserAgent(userAgent string) Option {
+	return func(w *Wikidump) error {
+		if userAgent == "" {
+			return errors.Errorf("Error: invalid empty User-Agent")
+		}
+		w.userAgent = userAgent
+		return nil
+	}
+}
+
+// WikimediaHosts are the hosts serving the dumps of Wikimedia.
+var WikimediaHosts = []string{"dumps.wikimedia.org"}
+
+// WithRedirectAllowlist restricts the hosts that downloads can be redirected to, such as WikimediaHosts. Redirects to
+// other hosts fail with ErrDisallowedRedirect, while the ones to allowed hosts are still subject to the CheckRedirect
+// of the client, if any (see WithHTTPClient). By default redirects are followed to any host.
+func WithRedirectAllowlist(hosts ...string) Option {
+	return func(w *Wikidump) error {
+		w.redirectHosts = make(map[string]bool, len(hosts))
+		for _, host := range hosts {
+			w.redirectHosts[host] = true
+		}
+		return nil
+	}
+}
@@ -0,0 +1,100 @@
+package wikidump
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// resumption describes the bytes already stored by a failed attempt of a download,
+// or the validators of the cached copy that the download revalidates.
+type resumption struct {
+	offset     int64        // number of bytes already stored
+	prefix     io.Reader    // the bytes already stored
+	restart    func() error // discards the bytes already stored, when the server doesn't serve ranges
+	conditions http.Header  // conditional headers revalidating a cached copy
+	validated  *validators  // if not nil, it's set to the validators of the response
+}
+
+// header returns the headers requesting the bytes after the ones already stored, if any, and the conditional ones.
+func (res resumption) header() http.Header {
+	if res.offset == 0 && len(res.conditions) == 0 {
+		return nil
+	}
+	header := res.conditions.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	if res.offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%v-", res.offset))
+	}
+	return header
+}
+
+// resumedBy reports whether resp serves the bytes after the ones already stored.
+func (res resumption) resumedBy(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusPartialContent &&
+		strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %v-", res.offset))
+}
+
+// fetchPartial downloads the resource associated with fi into f, resuming it after the bytes already in f.
+func (w Wikidump) fetchPartial(ctx context.Context, fi fileInfo, f *os.File) error {
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return errors.Wrap(err, "Error: unable to seek the following file: "+f.Name())
+	}
+	restart := func() error {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return f.Truncate(0)
+	}
+	if offset == 0 {
+		return w.fetch(ctx, fi, f)
+	}
+
+	w.logf("Resuming the download of the following url: %v after %v bytes", redactURL(fi.URL), offset)
+	err = w.fetchResumed(ctx, fi, f, resumption{offset: offset, prefix: io.NewSectionReader(f, 0, offset), restart: restart})
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		if err = restart(); err != nil {
+			return errors.Wrap(err, "Error: unable to restart the download of the following url: "+fi.URL)
+		}
+		return w.fetch(ctx, fi, f)
+	}
+	return err
+}
+
+// tempFileFor returns the temporary file storing fi, reopening partial if set.
+func (w Wikidump) tempFileFor(fi fileInfo, partial *string) (*os.File, error) {
+	if *partial != "" {
+		name := *partial
+		*partial = ""
+		if f, err := os.OpenFile(name, os.O_RDWR, 0); err == nil {
+			return f, nil
+		}
+		os.Remove(name)
+	}
+	f, err := ioutil.TempFile(w.tmpDir, path.Base(fi.URL))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error: unable to create temporary file in "+w.tmpDir)
+	}
+	return f, nil
+}
+
+// resumable reports whether the download of fi into f, failed with err, can be resumed by the next attempt:
+// some bytes must have been received, not in segments, and the download must not be corrupt.
+func (w Wikidump) resumable(fi fileInfo, f *os.File, err error) bool {
+	if w.segmented(fi) || errors.Is(err, ErrChecksumMismatch) {
+		return false
+	}
+	info, statErr := f.Stat()
+	return statErr == nil && info.Size() > 0
+}
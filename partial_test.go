@@ -0,0 +1,64 @@
+package wikidump
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResume(t *testing.T) {
+	info := name2MyInfo["/helloword.bz2"]
+	half := len(info.Data) / 2
+	for _, ranges := range []bool{true, false} {
+		var mu sync.Mutex
+		var requested []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requested = append(requested, r.Header.Get("Range"))
+			attempt := len(requested)
+			mu.Unlock()
+			switch {
+			case attempt == 1:
+				//the first attempt breaks after half the file
+				w.Header().Set("Content-Length", strconv.Itoa(len(info.Data)))
+				w.Write(info.Data[:half])
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			case ranges:
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(info.Data))
+			default:
+				w.Write(info.Data)
+			}
+		}))
+
+		tmpDir, err := ioutil.TempDir("", "wikidump")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tDump := Wikidump{tmpDir: tmpDir}
+		r, err := tDump.open(context.Background(), fileInfo{URL: server.URL + "/helloword.bz2", SHA1: info.SHA1})
+		if err != nil {
+			t.Fatal("open returns ", err)
+		}
+		if data, err := ioutil.ReadAll(r); err != nil || string(data) != helloword {
+			t.Error("Reading returns ", string(data), err)
+		}
+		r.Close()
+		server.Close()
+
+		if len(requested) != 2 || requested[1] != "bytes="+strconv.Itoa(half)+"-" {
+			t.Error("The second attempt should resume after the bytes received, while the requested ranges are", requested)
+		}
+		if files, _ := ioutil.ReadDir(tmpDir); len(files) != 0 {
+			t.Error("Temporary files should be removed, while there are", len(files))
+		}
+		os.RemoveAll(tmpDir)
+	}
+}
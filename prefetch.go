@@ -0,0 +1,80 @@
+package wikidump
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// WithPrefetch sets the number of upcoming parts of a multi-part file that Open downloads concurrently while
+// the current one is read. Parts are still returned in order, and at most n of them are stored ahead of the current one.
+// It has no effect along with WithShuffledParts. By default parts are downloaded one at a time, as they're requested.
+func WithPrefetch(n int) Option {
+	return func(w *Wikidump) error {
+		if n < 0 {
+			return errors.Errorf("Error: invalid prefetch of %v parts", n)
+		}
+		w.prefetch = n
+		return nil
+	}
+}
+
+// prefetched is the outcome of the download of a part.
+type prefetched struct {
+	r   virtualFile
+	err error
+}
+
+// prefetcher downloads in the background the parts of a file following the one being read.
+type prefetcher struct {
+	w       Wikidump
+	ffi     []fileInfo        // the parts whose download isn't started yet
+	pending []chan prefetched // the downloads started, in order
+}
+
+// next returns the next part stored, after starting the downloads of up to w.prefetch following ones.
+func (p *prefetcher) next(ctx context.Context) (virtualFile, error) {
+	for len(p.pending) <= p.w.prefetch && len(p.ffi) > 0 {
+		download := make(chan prefetched, 1)
+		go func(fi fileInfo) {
+			r, err := p.w.stubbornStore(ctx, fi)
+			download <- prefetched{r, err}
+		}(p.ffi[0])
+		p.pending, p.ffi = append(p.pending, download), p.ffi[1:]
+	}
+	if len(p.pending) == 0 {
+		return virtualFile{}, errors.New("Error: no parts left to prefetch")
+	}
+
+	result := <-p.pending[0]
+	p.pending = p.pending[1:]
+	switch {
+	case result.err != nil && ctx.Err() != nil:
+		p.release() //the downloads ahead are being stopped too, so that no part survives the cancellation
+	case result.err != nil:
+		p.discard()
+	}
+	return result.r, result.err
+}
+
+// discard stops handing out parts, closing in the background the ones downloaded ahead.
+func (p *prefetcher) discard() {
+	pending := p.pending
+	p.pending, p.ffi = nil, nil
+	go closePrefetched(pending)
+}
+
+// release stops handing out parts, closing the ones downloaded ahead once their downloads are over.
+func (p *prefetcher) release() {
+	pending := p.pending
+	p.pending, p.ffi = nil, nil
+	closePrefetched(pending)
+}
+
+func closePrefetched(pending []chan prefetched) {
+	for _, download := range pending {
+		if result := <-download; result.err == nil {
+			result.r.Close()
+		}
+	}
+}
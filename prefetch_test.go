@@ -0,0 +1,124 @@
+package wikidump
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPrefetch(t *testing.T) {
+	name2Info := map[string]myInfo{}
+	for i := 1; i <= 5; i++ {
+		name2Info[fmt.Sprintf("/part%v.gz", i)] = gzipMyInfo(fmt.Sprintf("part %v", i))
+	}
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if inFlight++; inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(100 * time.Millisecond)
+		w.Write(name2Info[r.URL.Path].Data)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	var ffi []fileInfo
+	for i := 1; i <= 5; i++ {
+		name := fmt.Sprintf("/part%v.gz", i)
+		ffi = append(ffi, fileInfo{URL: server.URL + name, SHA1: name2Info[name].SHA1})
+	}
+	tDump, err := Wikidump{file2Info: map[string][]fileInfo{"parts": ffi}}.With(WithPrefetch(2))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+
+	next := tDump.Open("parts")
+	for i := 1; i <= 5; i++ {
+		r, err := next(context.Background())
+		if err != nil {
+			t.Fatal("The iterator returns ", err)
+		}
+		if data, err := ioutil.ReadAll(r); err != nil || string(data) != fmt.Sprintf("part %v", i) {
+			t.Error("Reading part", i, "returns", string(data), err)
+		}
+		r.Close()
+	}
+	if _, err := next(context.Background()); err != io.EOF {
+		t.Error("The iterator should be depleted, while it returns ", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if maxInFlight != 3 {
+		t.Error("The current part and 2 upcoming ones should be downloaded concurrently, while at most", maxInFlight, "are")
+	}
+}
+
+func TestPrefetchCancel(t *testing.T) {
+	server, _ := countingServer()
+	defer server.Close()
+	info := name2MyInfo["/helloword.gz"]
+	ffi := []fileInfo{{URL: server.URL + "/helloword.gz", SHA1: info.SHA1}, {URL: server.URL + "/helloword.gz", SHA1: info.SHA1}}
+	tDump, err := Wikidump{file2Info: map[string][]fileInfo{"parts": ffi}}.With(WithPrefetch(1))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	if _, err := (Wikidump{}).With(WithPrefetch(-1)); err == nil {
+		t.Error("A negative prefetch should be invalid")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	next := tDump.Open("parts")
+	if _, err := next(ctx); err == nil {
+		t.Error("The iterator should fail with a cancelled context")
+	}
+	if _, err := next(context.Background()); err == nil {
+		t.Error("The iterator should keep returning its error")
+	}
+}
+
+func TestOpenAllRelease(t *testing.T) {
+	server, _ := countingServer()
+	defer server.Close()
+	info := name2MyInfo["/helloword.gz"]
+	var ffi []fileInfo
+	for i := 0; i < 4; i++ {
+		ffi = append(ffi, fileInfo{URL: server.URL + "/helloword.gz", SHA1: info.SHA1})
+	}
+
+	for name, option := range map[string]Option{"prefetch": WithPrefetch(3), "shuffled": WithShuffledParts(true)} {
+		tmpDir, err := ioutil.TempDir("", "wikidump")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(tmpDir)
+		tDump, err := Wikidump{tmpDir: tmpDir, file2Info: map[string][]fileInfo{"parts": ffi}}.With(option)
+		if err != nil {
+			t.Fatal("With returns ", err)
+		}
+
+		r, err := tDump.OpenAll(context.Background(), "parts")
+		if err != nil {
+			t.Fatal("OpenAll returns ", err)
+		}
+		if _, err := io.ReadFull(r, make([]byte, 3)); err != nil {
+			t.Error(name, ": reading returns ", err)
+		}
+		r.Close()
+		if files, _ := ioutil.ReadDir(tmpDir); len(files) != 0 {
+			t.Error(name, ": closing should release the parts stored ahead, while", len(files), "files are left")
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package wikidump
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket bounding the bytes per second received by all the downloads sharing it,
+// a nil *rateLimiter is unlimited.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	burst  float64 // capacity of the bucket, a second of traffic
+	tokens float64 // may go below zero, the debt is paid back by waiting
+	last   time.Time
+}
+
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	rate := float64(bytesPerSec)
+	return &rateLimiter{rate: rate, burst: rate, tokens: rate, last: time.Now()}
+}
+
+// chunk is the largest read, so that each one waits about a tenth of a second at most.
+func (l *rateLimiter) chunk() int {
+	if c := int(l.rate / 10); c > 1 {
+		return c
+	}
+	return 1
+}
+
+// wait takes n bytes from the bucket, waiting until they're paid back if it's overdrawn.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttled returns r reading at the pace allowed by l, r itself if l is nil.
+func (l *rateLimiter) throttled(ctx context.Context, r io.ReadCloser) io.ReadCloser {
+	if l == nil {
+		return r
+	}
+	return &throttledReader{r, ctx, l}
+}
+
+type throttledReader struct {
+	io.ReadCloser
+	ctx     context.Context
+	limiter *rateLimiter
+}
+
+func (t *throttledReader) Read(p []byte) (n int, err error) {
+	if chunk := t.limiter.chunk(); len(p) > chunk {
+		p = p[:chunk]
+	}
+	n, err = t.ReadCloser.Read(p)
+	if waitErr := t.limiter.wait(t.ctx, n); waitErr != nil && err == nil {
+		err = waitErr
+	}
+	return
+}
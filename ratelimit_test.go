@@ -0,0 +1,67 @@
+package wikidump
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	content := bytes.Repeat([]byte("wikidump"), 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	if _, err := (Wikidump{}).With(WithRateLimit(0)); err == nil {
+		t.Error("WithRateLimit should reject a non positive limit")
+	}
+
+	//the two downloads fit a second of traffic each, but not together
+	tDump, err := Wikidump{}.With(WithRateLimit(10000), WithShouldRetry(func(error, int) bool { return false }))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, name := range []string{"/a.txt", "/b.txt"} {
+		wg.Add(1)
+		go func(fi fileInfo) {
+			defer wg.Done()
+			r, err := tDump.open(context.Background(), fi)
+			if err != nil {
+				t.Error("open returns ", err)
+				return
+			}
+			defer r.Close()
+			if data, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(data, content) {
+				t.Error("Reading returns ", len(data), err)
+			}
+		}(fileInfo{URL: server.URL + name, SHA1: sha1Of(content)})
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Error("The limit should be shared by the downloads, while they take ", elapsed)
+	}
+
+	//a throttled download is cancelled
+	tDump, err = Wikidump{}.With(WithRateLimit(100), WithShouldRetry(func(error, int) bool { return false }))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if _, err := tDump.open(ctx, fileInfo{URL: server.URL + "/c.txt", SHA1: sha1Of(content)}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("open should return the error of the context, while it returns ", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Error("The cancellation should interrupt the wait, while it takes ", elapsed)
+	}
+}
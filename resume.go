@@ -0,0 +1,120 @@
+package wikidump
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// downloadProgress records the resources stored by DownloadAll, it's shared by the wikidumps derived from the same one.
+type downloadProgress struct {
+	mu    sync.Mutex
+	parts map[string]storedPart // by local path
+}
+
+type storedPart struct {
+	URL     string    `json:"url"`
+	SHA1    string    `json:"sha1"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+}
+
+type resumeToken struct {
+	Lang  string                `json:"lang"`
+	Date  time.Time             `json:"date"`
+	Parts map[string]storedPart `json:"parts"`
+}
+
+func newDownloadProgress() *downloadProgress {
+	return &downloadProgress{parts: map[string]storedPart{}}
+}
+
+// record marks as complete the resource associated with fi stored in path.
+func (p *downloadProgress) record(path string, fi fileInfo) {
+	if p == nil {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.parts[path] = storedPart{fi.URL, fi.SHA1, info.Size(), info.ModTime()}
+}
+
+// completed reports whether the resource associated with fi is recorded as complete in path,
+// and the file is unchanged since then.
+func (p *downloadProgress) completed(path string, fi fileInfo) bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	part, ok := p.parts[path]
+	p.mu.Unlock()
+	if !ok || part.URL != fi.URL || part.SHA1 != fi.SHA1 {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Size() == part.Size && info.ModTime().Equal(part.ModTime)
+}
+
+// ResumeToken captures which resources DownloadAll already stored, so that another process can continue
+// from there with ResumeFrom.
+func (w Wikidump) ResumeToken() ([]byte, error) {
+	if w.progress == nil {
+		return nil, errors.New("Error: no progress tracked by the wikidump")
+	}
+	w.progress.mu.Lock()
+	token := resumeToken{w.lang, w.date, make(map[string]storedPart, len(w.progress.parts))}
+	for path, part := range w.progress.parts {
+		token.Parts[path] = part
+	}
+	w.progress.mu.Unlock()
+
+	data, err := json.Marshal(token)
+	return data, errors.Wrap(err, "Error: unable to Marshal the resume token")
+}
+
+// ResumeFrom returns a copy of the wikidump whose DownloadAll skips the resources recorded in token as stored.
+// The recorded resources are verified again, concurrently as in VerifyMirror, and a resource is skipped only if
+// its file matches its checksum and it's unchanged since then, otherwise DownloadAll downloads it again.
+func (w Wikidump) ResumeFrom(token []byte) (Wikidump, error) {
+	var t resumeToken
+	if err := json.Unmarshal(token, &t); err != nil {
+		return Wikidump{}, errors.Wrap(err, "Error: unable to Unmarshal the resume token")
+	}
+	if t.Lang != w.lang || !t.Date.Equal(w.date) {
+		return Wikidump{}, errors.Errorf("Error: the resume token refers to the %v dump of %v", t.Lang, t.Date.Format("20060102"))
+	}
+
+	url2Info := map[string]fileInfo{}
+	for _, fi := range w.sortedInfos() {
+		url2Info[fi.URL] = fi
+	}
+	var paths []string
+	var ffi []fileInfo
+	for path, part := range t.Parts {
+		fi, ok := url2Info[part.URL]
+		if !ok || fi.SHA1 != part.SHA1 {
+			continue
+		}
+		paths, ffi = append(paths, path), append(ffi, fi)
+	}
+	sums, err := w.checksums(context.Background(), ffi, paths)
+	if err != nil {
+		return Wikidump{}, err
+	}
+
+	w.progress = newDownloadProgress()
+	for i, sum := range sums {
+		if sum.err == nil && sum.matches(ffi[i]) {
+			w.progress.parts[paths[i]] = t.Parts[paths[i]]
+		}
+	}
+	return w, nil
+}
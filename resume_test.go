@@ -0,0 +1,80 @@
+package wikidump
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResumeToken(t *testing.T) {
+	server, requests := countingServer()
+	defer server.Close()
+
+	index := fmt.Sprintf(`{"jobs": {
+	"gz": {"status": "done", "files": {"helloword.gz": {"url": "%v/helloword.gz", "sha1": "%v"}}},
+	"bz2": {"status": "done", "files": {"helloword.bz2": {"url": "%v/helloword.bz2", "sha1": "%v"}}},
+	"7z": {"status": "done", "files": {"helloword.7z": {"url": "%v/helloword.7z", "sha1": "%v"}}}
+}}`, server.URL, name2MyInfo["/helloword.gz"].SHA1, server.URL, name2MyInfo["/helloword.bz2"].SHA1, server.URL, name2MyInfo["/helloword.7z"].SHA1)
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	dir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//the first process stores two files and checkpoints
+	first, err := FromIndex("", "en", strings.NewReader(index), date)
+	if err != nil {
+		t.Fatal("FromIndex returns ", err)
+	}
+	if err := first.DownloadAll(context.Background(), dir, "gz", "bz2"); err != nil {
+		t.Fatal("DownloadAll returns ", err)
+	}
+	token, err := first.ResumeToken()
+	if err != nil {
+		t.Fatal("ResumeToken returns ", err)
+	}
+
+	//one of them is corrupted before the second process resumes, keeping its size and modification time
+	bz2 := filepath.Join(dir, "helloword.bz2")
+	info, err := os.Stat(bz2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(bz2, make([]byte, info.Size()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(bz2, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	second, err := FromIndex("", "en", strings.NewReader(index), date)
+	if err != nil {
+		t.Fatal("FromIndex returns ", err)
+	}
+	if second, err = second.ResumeFrom(token); err != nil {
+		t.Fatal("ResumeFrom returns ", err)
+	}
+	if err := second.DownloadAll(context.Background(), dir, "gz", "bz2", "7z"); err != nil {
+		t.Fatal("DownloadAll returns ", err)
+	}
+
+	for name, count := range map[string]int{"/helloword.gz": 1, "/helloword.bz2": 2, "/helloword.7z": 1} {
+		if requests(name) != count {
+			t.Error(name, "should be requested", count, "times, while it's requested", requests(name), "times")
+		}
+		if sha1, err := fileSHA1(filepath.Join(dir, filepath.Base(name))); err != nil || sha1 != name2MyInfo[name].SHA1 {
+			t.Error(name, "is not stored correctly: ", err)
+		}
+	}
+
+	other, _ := FromIndex("", "it", strings.NewReader(index), date)
+	if _, err := other.ResumeFrom(token); err == nil {
+		t.Error("ResumeFrom should reject the token of another dump")
+	}
+}
@@ -0,0 +1,93 @@
+package wikidump
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// validators are the ETag and Last-Modified headers of a cached download, used to revalidate it.
+type validators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// revalidationPath returns the path in the cache of fi keyed by its url, or an empty string if fi isn't revalidated.
+// Only resources without any sum, which can't be cached under it nor verified, are revalidated.
+func (w Wikidump) revalidationPath(fi fileInfo) string {
+	if _, _, sum := fi.checksum(); w.cacheDir == "" || sum != "" {
+		return ""
+	}
+	return filepath.Join(w.cacheDir, fmt.Sprintf("url-%x-%v", sha1.Sum([]byte(fi.URL)), path.Base(fi.URL)))
+}
+
+// revalidate opens the cached copy of fi if the server reports it's not modified since it was downloaded,
+// otherwise it downloads fi again into the cache, recording its validators for the next time.
+func (w Wikidump) revalidate(ctx context.Context, fi fileInfo) (virtualFile, error) {
+	cachePath := w.revalidationPath(fi)
+	validatorsPath := cachePath + ".validators"
+	header := http.Header{}
+	if _, err := os.Stat(cachePath); err == nil {
+		var v validators
+		if data, err := ioutil.ReadFile(validatorsPath); err == nil && json.Unmarshal(data, &v) == nil {
+			if v.ETag != "" {
+				header.Set("If-None-Match", v.ETag)
+			}
+			if v.LastModified != "" {
+				header.Set("If-Modified-Since", v.LastModified)
+			}
+		}
+	}
+
+	tempFile, err := ioutil.TempFile(w.cacheDir, ".tmp-"+path.Base(cachePath))
+	if err != nil {
+		return virtualFile{}, errors.Wrap(err, "Error: unable to create temporary file in "+w.cacheDir)
+	}
+	fail := func(e error) (virtualFile, error) {
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+		return virtualFile{}, e
+	}
+	var v validators
+	err = w.fetchResumed(ctx, fi, tempFile, resumption{conditions: header, validated: &v})
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotModified {
+		fail(nil)
+		w.logf("Not modified since cached the following url: %v", redactURL(fi.URL))
+		return openCached(cachePath)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if err = tempFile.Close(); err != nil {
+		return fail(errors.Wrap(err, "Error: unable to close the following file: "+tempFile.Name()))
+	}
+
+	os.Remove(validatorsPath) //stale validators must not outlive the file they refer to
+	if err = os.Rename(tempFile.Name(), cachePath); err != nil {
+		return fail(errors.Wrap(err, "Error: unable to move to the cache the following file: "+tempFile.Name()))
+	}
+	if v != (validators{}) {
+		data, _ := json.Marshal(v)
+		if err = ioutil.WriteFile(validatorsPath, data, 0644); err != nil {
+			w.logf("Warning: unable to record the validators of the following url: %v", redactURL(fi.URL))
+		}
+	}
+	return openCached(cachePath)
+}
+
+func openCached(cachePath string) (virtualFile, error) {
+	f, err := os.Open(cachePath)
+	if err != nil {
+		return virtualFile{}, errors.Wrap(err, "Error: unable to open the following cached file: "+cachePath)
+	}
+	return virtualFile{f, f.Close, cachePath}, nil
+}
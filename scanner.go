@@ -0,0 +1,42 @@
+package wikidump
+
+import (
+	"bufio"
+	"context"
+	"io"
+)
+
+// Scanner tokenizes the decompressed content of a dump file.
+// It is the caller's responsibility to call Close when done.
+type Scanner struct {
+	*bufio.Scanner
+	r io.ReadCloser
+}
+
+// Close releases the resources associated with the scanner.
+func (s *Scanner) Close() error {
+	return s.r.Close()
+}
+
+// OpenScanner returns a scanner over the decompressed content of all the resources associated with filename,
+// tokenized by split. Resources are downloaded when needed while scanning and any error is reported by Err.
+func (w Wikidump) OpenScanner(ctx context.Context, filename string, split bufio.SplitFunc) (*Scanner, error) {
+	if err := w.CheckFor(filename); err != nil {
+		return nil, err
+	}
+
+	max := w.scanBuffer
+	if max == 0 {
+		max = bufio.MaxScanTokenSize
+	}
+	initial := 4096
+	if max < initial {
+		initial = max
+	}
+
+	r := w.openAll(ctx, filename)
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, initial), max)
+	s.Split(split)
+	return &Scanner{s, r}, nil
+}
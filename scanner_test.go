@@ -0,0 +1,69 @@
+package wikidump
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestOpenScanner(t *testing.T) {
+	ffi := make([]fileInfo, 0, len(name2MyInfo))
+	for name, info := range name2MyInfo {
+		ffi = append(ffi, fileInfo{URL: "http://" + address + name, SHA1: info.SHA1})
+	}
+	tDump := Wikidump{file2Info: map[string][]fileInfo{"helloword": ffi}}
+
+	splitOnBang := func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if i := bytes.IndexByte(data, '!'); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+
+	s, err := tDump.OpenScanner(context.Background(), "helloword", splitOnBang)
+	if err != nil {
+		t.Fatal("OpenScanner returns ", err)
+	}
+	defer s.Close()
+
+	count := 0
+	for ; s.Scan(); count++ {
+		if token := s.Text(); token != strings.TrimSuffix(helloword, "!") {
+			t.Error("Token should be " + strings.TrimSuffix(helloword, "!") + " but it's " + token)
+		}
+	}
+	if err := s.Err(); err != nil {
+		t.Error("Scanner returns ", err)
+	}
+	if count != len(ffi) {
+		t.Error("Scanner should return", len(ffi), "tokens, while it returns", count)
+	}
+	if err := s.Close(); err != nil {
+		t.Error("Closing returns ", err)
+	}
+
+	tDump, err = tDump.With(WithScanBuffer(4))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	s, err = tDump.OpenScanner(context.Background(), "helloword", splitOnBang)
+	if err != nil {
+		t.Fatal("OpenScanner returns ", err)
+	}
+	defer s.Close()
+	for s.Scan() {
+		t.Error("Scanner should not return tokens longer than its buffer")
+	}
+	if err := s.Err(); err != bufio.ErrTooLong {
+		t.Error("Scanner should return bufio.ErrTooLong, while it returns ", err)
+	}
+
+	if _, err := tDump.OpenScanner(context.Background(), "nothing", bufio.ScanLines); err == nil {
+		t.Error("Error should be not null")
+	}
+}
@@ -0,0 +1,157 @@
+package wikidump
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// WithSegments sets the number of segments that resources stored in files are split into, downloading them
+// concurrently with range requests. It applies only to resources whose size is reported by the index.
+// When the server reports the SHA-256 digest of each segment in the Content-Digest header, corrupt segments
+// are detected and downloaded again on their own. By default resources are downloaded with a single request.
+func WithSegments(n int) Option {
+	return func(w *Wikidump) error {
+		if n <= 0 {
+			return errors.Errorf("Error: invalid number of segments %v", n)
+		}
+		w.segments = n
+		return nil
+	}
+}
+
+// segmentAttempts is the number of times a corrupt segment is downloaded before giving up.
+const segmentAttempts = 3
+
+// errNoRanges is returned when the server doesn't serve range requests.
+var errNoRanges = errors.New("range requests not supported")
+
+// fetchInto downloads the resource associated with fi into f, in segments if enabled.
+func (w Wikidump) fetchInto(ctx context.Context, fi fileInfo, f *os.File) error {
+	if !w.segmented(fi) {
+		return w.fetchPartial(ctx, fi, f)
+	}
+
+	err := w.fetchSegments(ctx, fi, f)
+	if errors.Cause(err) != errNoRanges {
+		return err
+	}
+	w.logf("Warning: ranges not supported for the following url: %v, proceeding with a single request", redactURL(fi.URL))
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "Error: unable to seek the following file: "+f.Name())
+	}
+	if err = f.Truncate(0); err != nil {
+		return errors.Wrap(err, "Error: unable to truncate the following file: "+f.Name())
+	}
+	return w.fetch(ctx, fi, f)
+}
+
+// segmented reports whether the resource associated with fi is downloaded in segments.
+func (w Wikidump) segmented(fi fileInfo) bool {
+	return w.segments > 1 && fi.Size >= int64(w.segments) && w.fetcher == nil
+}
+
+// fetchSegments downloads concurrently the segments of the resource associated with fi into f,
+// then verifies the SHA1 sum of the whole.
+func (w Wikidump) fetchSegments(ctx context.Context, fi fileInfo, f *os.File) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	segmentSize := (fi.Size + int64(w.segments) - 1) / int64(w.segments)
+	errs := make([]error, w.segments)
+	wg := sync.WaitGroup{}
+	for i := 0; i < w.segments; i++ {
+		start, end := int64(i)*segmentSize, int64(i+1)*segmentSize
+		if end > fi.Size {
+			end = fi.Size
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for attempt := 1; attempt <= segmentAttempts; attempt++ {
+				if errs[i] = w.fetchSegment(ctx, fi, f, start, end); errors.Cause(errs[i]) != errCorruptSegment {
+					break
+				}
+				w.logf("Warning: corrupt segment %v-%v of the following url: %v, downloading it again", start, end, redactURL(fi.URL))
+			}
+			if errs[i] != nil {
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if errors.Cause(err) == errNoRanges {
+			return err
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.verifyStored(f.Name(), fi)
+}
+
+// errCorruptSegment is returned when a segment doesn't match its digest.
+var errCorruptSegment = errors.New("corrupt segment")
+
+// fetchSegment downloads the bytes in [start, end) of the resource associated with fi into f at the same offset.
+func (w Wikidump) fetchSegment(ctx context.Context, fi fileInfo, f *os.File, start, end int64) error {
+	body, resp, err := w.streamWith(ctx, fi, http.Header{"Range": {fmt.Sprintf("bytes=%v-%v", start, end-1)}})
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return errNoRanges
+	}
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(&offsetWriter{f, start}, hash), io.LimitReader(body, end-start))
+	w.stats.update(func(s *Stats) { s.BytesReceived += n })
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "Error: unable to copy to file the following url: "+fi.URL)
+	case n != end-start:
+		return errors.Wrapf(errCorruptSegment, "%v bytes received instead of %v", n, end-start)
+	}
+
+	if digest, ok := contentSHA256(resp.Header); ok && digest != base64.StdEncoding.EncodeToString(hash.Sum(nil)) {
+		return errors.Wrapf(errCorruptSegment, "mismatched digest for the segment %v-%v of the following url: %v", start, end, fi.URL)
+	}
+	return nil
+}
+
+// contentSHA256 returns the base64 SHA-256 digest from a Content-Digest header, such as sha-256=:base64:.
+func contentSHA256(header http.Header) (string, bool) {
+	for _, field := range strings.Split(header.Get("Content-Digest"), ",") {
+		field = strings.TrimSpace(field)
+		if strings.HasPrefix(field, "sha-256=:") && strings.HasSuffix(field, ":") && len(field) > len("sha-256=::") {
+			return field[len("sha-256=:") : len(field)-1], true
+		}
+	}
+	return "", false
+}
+
+// offsetWriter writes sequentially into f starting from off.
+type offsetWriter struct {
+	f   *os.File
+	off int64
+}
+
+func (o *offsetWriter) Write(p []byte) (n int, err error) {
+	n, err = o.f.WriteAt(p, o.off)
+	o.off += int64(n)
+	return
+}
@@ -0,0 +1,83 @@
+package wikidump
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestSegments(t *testing.T) {
+	data := make([]byte, 4000)
+	rand.New(rand.NewSource(42)).Read(data)
+
+	//the first response for the second segment is corrupted
+	var mu sync.Mutex
+	range2Count := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var start, end int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil {
+			w.Write(data)
+			return
+		}
+		segment := data[start : end+1]
+		digest := sha256.Sum256(segment)
+
+		mu.Lock()
+		range2Count[r.Header.Get("Range")]++
+		corrupt := start == 1000 && range2Count[r.Header.Get("Range")] == 1
+		mu.Unlock()
+		if corrupt {
+			segment = append([]byte{}, segment...)
+			segment[0]++
+		}
+
+		w.Header().Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(digest[:])+":")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(segment)
+	}))
+	defer server.Close()
+
+	tDump, err := Wikidump{}.With(WithSegments(4))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	fi := fileInfo{URL: server.URL + "/data.txt", SHA1: fmt.Sprintf("%x", sha1.Sum(data)), Size: int64(len(data))}
+	r, err := tDump.open(context.Background(), fi)
+	if err != nil {
+		t.Fatal("open returns ", err)
+	}
+	defer r.Close()
+	if downloaded, err := ioutil.ReadAll(r); err != nil || string(downloaded) != string(data) {
+		t.Error("The downloaded data differs: ", err)
+	}
+
+	expected := map[string]int{"bytes=0-999": 1, "bytes=1000-1999": 2, "bytes=2000-2999": 1, "bytes=3000-3999": 1}
+	mu.Lock()
+	defer mu.Unlock()
+	for rng, count := range expected {
+		if range2Count[rng] != count {
+			t.Error("Range", rng, "should be requested", count, "times, while it's requested", range2Count[rng], "times")
+		}
+	}
+
+	//servers without range requests are downloaded with a single request
+	plain, _ := countingServer()
+	defer plain.Close()
+	info := name2MyInfo["/helloword.gz"]
+	fi = fileInfo{URL: plain.URL + "/helloword.gz", SHA1: info.SHA1, Size: int64(len(info.Data))}
+	if r, err = tDump.open(context.Background(), fi); err != nil {
+		t.Fatal("open returns ", err)
+	}
+	defer r.Close()
+	if data, err := ioutil.ReadAll(r); err != nil || string(data) != helloword {
+		t.Error("Reading returns ", string(data), err)
+	}
+}
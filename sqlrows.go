@@ -0,0 +1,170 @@
+package wikidump
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// SQLRows returns an iterator over the rows of a SQL data dump from dumps.wikimedia.org, NULL values are reported as not valid.
+// Values are tokenized following the MySQL dialect: quoted strings are unescaped, hex literals (0x... and X'...')
+// are decoded and _binary prefixes are dropped. Once the iterator is depleted, it returns an io.EOF error.
+func SQLRows(r io.Reader) func() ([]sql.NullString, error) {
+	t := &sqlTokenizer{file: bufio.NewReader(r)}
+	return func() ([]sql.NullString, error) {
+		if t.err != nil {
+			return nil, t.err
+		}
+		row, err := t.nextRow()
+		if err != nil {
+			t.err = err
+		}
+		return row, err
+	}
+}
+
+// sqlTokenizer parses the tuples of the INSERT statements of a SQL dump, one statement per line.
+type sqlTokenizer struct {
+	file *bufio.Reader
+	line []byte //remaining tuples of the current statement
+	err  error
+}
+
+func (t *sqlTokenizer) nextRow() (row []sql.NullString, err error) {
+	for len(t.line) == 0 {
+		if t.line, err = t.nextStatement(); err != nil {
+			return nil, err
+		}
+	}
+
+	if !t.consume('(') {
+		return nil, errors.Errorf("SQLRows: expected ( in input.")
+	}
+	for {
+		value, err := t.value()
+		if err != nil {
+			return nil, err
+		}
+		row = append(row, value)
+
+		if t.consume(')') {
+			break
+		}
+		if !t.consume(',') {
+			return nil, errors.Errorf("SQLRows: expected , or ) in input.")
+		}
+	}
+
+	switch {
+	case t.consume(','):
+	case t.consume(';'), len(t.line) == 0:
+		t.line = nil
+	default:
+		return nil, errors.Errorf("SQLRows: expected , or ; after a row.")
+	}
+	return row, nil
+}
+
+// nextStatement returns the tuples of the next INSERT statement.
+func (t *sqlTokenizer) nextStatement() (line []byte, err error) {
+	for !bytes.HasPrefix(line, []byte("INSERT INTO")) {
+		if err != nil {
+			return nil, err
+		}
+		line, err = t.file.ReadBytes('\n')
+	}
+
+	i := bytes.Index(line, []byte(" VALUES "))
+	if i == -1 {
+		return nil, errors.Errorf("SQLRows: invalid input error.")
+	}
+	return bytes.TrimSpace(line[i+len(" VALUES "):]), nil
+}
+
+// consume skips the spaces and then c, if it's next.
+func (t *sqlTokenizer) consume(c byte) bool {
+	t.line = bytes.TrimLeft(t.line, " \t\r\n")
+	if len(t.line) == 0 || t.line[0] != c {
+		return false
+	}
+	t.line = t.line[1:]
+	return true
+}
+
+func (t *sqlTokenizer) value() (sql.NullString, error) {
+	t.line = bytes.TrimLeft(t.line, " \t\r\n")
+	if bytes.HasPrefix(t.line, []byte("_binary")) {
+		t.line = bytes.TrimLeft(t.line[len("_binary"):], " ")
+	}
+
+	switch {
+	case len(t.line) > 0 && t.line[0] == '\'':
+		s, err := t.quoted()
+		return sql.NullString{String: s, Valid: true}, err
+	case len(t.line) > 1 && (t.line[0] == 'X' || t.line[0] == 'x') && t.line[1] == '\'':
+		t.line = t.line[1:]
+		s, err := t.quoted()
+		if err != nil {
+			return sql.NullString{}, err
+		}
+		return unhex(s)
+	}
+
+	i := bytes.IndexAny(t.line, ",)")
+	if i == -1 {
+		return sql.NullString{}, errors.Errorf("SQLRows: unterminated value in input.")
+	}
+	token := string(bytes.TrimSpace(t.line[:i]))
+	t.line = t.line[i:]
+
+	switch {
+	case token == "":
+		return sql.NullString{}, errors.Errorf("SQLRows: empty value in input.")
+	case token == "NULL":
+		return sql.NullString{}, nil
+	case len(token) > 2 && (token[:2] == "0x" || token[:2] == "0X"):
+		return unhex(token[2:])
+	}
+	return sql.NullString{String: token, Valid: true}, nil
+}
+
+// sqlEscapes maps the MySQL escape sequences to the characters they stand for,
+// other escaped characters stand for themselves.
+var sqlEscapes = map[byte]byte{'0': 0, 'b': '\b', 'n': '\n', 'r': '\r', 't': '\t', 'Z': 26}
+
+// quoted unescapes the quoted string at the beginning of the line.
+func (t *sqlTokenizer) quoted() (string, error) {
+	b := make([]byte, 0, 32)
+	for i := 1; i < len(t.line); i++ {
+		switch c := t.line[i]; {
+		case c == '\\' && i+1 < len(t.line):
+			i++
+			if e, ok := sqlEscapes[t.line[i]]; ok {
+				b = append(b, e)
+			} else {
+				b = append(b, t.line[i])
+			}
+		case c == '\'' && i+1 < len(t.line) && t.line[i+1] == '\'':
+			i++
+			b = append(b, '\'')
+		case c == '\'':
+			t.line = t.line[i+1:]
+			return string(b), nil
+		default:
+			b = append(b, c)
+		}
+	}
+	return "", errors.Errorf("SQLRows: unterminated string in input.")
+}
+
+func unhex(s string) (sql.NullString, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return sql.NullString{}, errors.Wrap(err, "SQLRows: invalid hex literal in input")
+	}
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
@@ -0,0 +1,45 @@
+package wikidump
+
+import (
+	"database/sql"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSQLRows(t *testing.T) {
+	dump := "-- MySQL dump 10.16\n" +
+		"INSERT INTO `t` VALUES (1,'it\\'s, (really)',NULL),(-2.5,'a\\\\b\\nc','it''s'),(0x48692C29,_binary 'x\\0y',X'2829');\n" +
+		"INSERT INTO `t` VALUES ( 3 , '' , 'NULL' );\n"
+	s := func(s string) sql.NullString { return sql.NullString{String: s, Valid: true} }
+	expected := [][]sql.NullString{
+		{s("1"), s("it's, (really)"), {}},
+		{s("-2.5"), s("a\\b\nc"), s("it's")},
+		{s("Hi,)"), s("x\x00y"), s("()")},
+		{s("3"), s(""), s("NULL")},
+	}
+
+	next := SQLRows(strings.NewReader(dump))
+	var rows [][]sql.NullString
+	row, err := next()
+	for ; err == nil; row, err = next() {
+		rows = append(rows, row)
+	}
+	if err != io.EOF {
+		t.Error("SQLRows iterator returns ", err)
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Rows should be %+v but they're %+v", expected, rows)
+	}
+
+	for _, invalid := range []string{
+		"INSERT INTO `t` VALUES (1,'unterminated);\n",
+		"INSERT INTO `t` VALUES (0xZZ);\n",
+		"INSERT INTO `t` VALUES (1 2;\n",
+	} {
+		if _, err := SQLRows(strings.NewReader(invalid))(); err == nil || err == io.EOF {
+			t.Error("SQLRows should fail on ", invalid, " while it returns ", err)
+		}
+	}
+}
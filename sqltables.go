@@ -0,0 +1,151 @@
+package wikidump
+
+import (
+	"database/sql"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// table2Columns maps the tables with a typed decoder to the names of their columns, in dump order.
+var table2Columns = map[string][]string{
+	"user_groups":      {"ug_user", "ug_group", "ug_expiry"},
+	"redirect":         {"rd_from", "rd_namespace", "rd_title", "rd_interwiki", "rd_fragment"},
+	"protected_titles": {"pt_namespace", "pt_title", "pt_user", "pt_reason_id", "pt_timestamp", "pt_expiry", "pt_create_perm"},
+}
+
+// UserGroup is a row of the user_groups table.
+type UserGroup struct {
+	User   uint32
+	Group  string
+	Expiry *time.Time // nil if the membership doesn't expire
+}
+
+// UserGroups returns an iterator over the rows of a user_groups SQL data dump.
+// Once the iterator is depleted, it returns an io.EOF error.
+func UserGroups(r io.Reader) func() (UserGroup, error) {
+	next := tableRows(r, "user_groups")
+	return func() (ug UserGroup, err error) {
+		row, err := next()
+		if err != nil {
+			return
+		}
+		d := rowDecoder{row: row}
+		ug = UserGroup{uint32(d.uint("ug_user", 32)), d.string("ug_group"), d.expiry("ug_expiry")}
+		return ug, d.err
+	}
+}
+
+// Redirect is a row of the redirect table.
+type Redirect struct {
+	From                       uint32
+	Namespace                  int32
+	Title, Interwiki, Fragment string
+}
+
+// Redirects returns an iterator over the rows of a redirect SQL data dump.
+// Once the iterator is depleted, it returns an io.EOF error.
+func Redirects(r io.Reader) func() (Redirect, error) {
+	next := tableRows(r, "redirect")
+	return func() (rd Redirect, err error) {
+		row, err := next()
+		if err != nil {
+			return
+		}
+		d := rowDecoder{row: row}
+		rd = Redirect{uint32(d.uint("rd_from", 32)), int32(d.int("rd_namespace", 32)), d.string("rd_title"), d.string("rd_interwiki"), d.string("rd_fragment")}
+		return rd, d.err
+	}
+}
+
+// ProtectedTitle is a row of the protected_titles table.
+type ProtectedTitle struct {
+	Namespace  int32
+	Title      string
+	User       uint32
+	ReasonID   uint64
+	Timestamp  time.Time
+	Expiry     *time.Time // nil if the protection doesn't expire
+	CreatePerm string
+}
+
+// ProtectedTitles returns an iterator over the rows of a protected_titles SQL data dump.
+// Once the iterator is depleted, it returns an io.EOF error.
+func ProtectedTitles(r io.Reader) func() (ProtectedTitle, error) {
+	next := tableRows(r, "protected_titles")
+	return func() (pt ProtectedTitle, err error) {
+		row, err := next()
+		if err != nil {
+			return
+		}
+		d := rowDecoder{row: row}
+		pt = ProtectedTitle{int32(d.int("pt_namespace", 32)), d.string("pt_title"), uint32(d.uint("pt_user", 32)),
+			d.uint("pt_reason_id", 64), d.timestamp("pt_timestamp"), d.expiry("pt_expiry"), d.string("pt_create_perm")}
+		return pt, d.err
+	}
+}
+
+// tableRows returns an iterator over the rows of a SQL data dump of table, indexed by column name.
+func tableRows(r io.Reader, table string) func() (map[string]sql.NullString, error) {
+	next, columns := SQLRows(r), table2Columns[table]
+	return func() (map[string]sql.NullString, error) {
+		values, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != len(columns) {
+			return nil, errors.Errorf("Error: %v row with %v values instead of %v", table, len(values), len(columns))
+		}
+		row := make(map[string]sql.NullString, len(columns))
+		for i, column := range columns {
+			row[column] = values[i]
+		}
+		return row, nil
+	}
+}
+
+// rowDecoder converts the values of a row, recording the first error.
+type rowDecoder struct {
+	row map[string]sql.NullString
+	err error
+}
+
+func (d *rowDecoder) string(column string) string {
+	return d.row[column].String
+}
+
+func (d *rowDecoder) uint(column string, bitSize int) uint64 {
+	v, err := strconv.ParseUint(d.row[column].String, 10, bitSize)
+	d.fail(column, err)
+	return v
+}
+
+func (d *rowDecoder) int(column string, bitSize int) int64 {
+	v, err := strconv.ParseInt(d.row[column].String, 10, bitSize)
+	d.fail(column, err)
+	return v
+}
+
+// timestamp parses a MediaWiki timestamp.
+func (d *rowDecoder) timestamp(column string) time.Time {
+	t, err := time.Parse("20060102150405", d.row[column].String)
+	d.fail(column, err)
+	return t
+}
+
+// expiry parses a MediaWiki expiry, that is a timestamp where NULL and infinity mean no expiry.
+func (d *rowDecoder) expiry(column string) *time.Time {
+	if v := d.row[column]; !v.Valid || v.String == "infinity" {
+		return nil
+	}
+	t := d.timestamp(column)
+	return &t
+}
+
+func (d *rowDecoder) fail(column string, err error) {
+	if err != nil && d.err == nil {
+		d.err = errors.Wrapf(err, "Error: invalid value for column %v", column)
+	}
+}
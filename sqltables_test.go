@@ -0,0 +1,55 @@
+package wikidump
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const userGroupsFixture = "-- MySQL dump 10.16\n" +
+	"CREATE TABLE `user_groups` (\n  `ug_user` int(5) unsigned NOT NULL DEFAULT '0'\n) ENGINE=InnoDB;\n" +
+	"INSERT INTO `user_groups` VALUES (1,'sysop',NULL),(42,'bot','20300101120000');\n" +
+	"INSERT INTO `user_groups` VALUES (7,'rollbacker',NULL);\n"
+
+func TestUserGroups(t *testing.T) {
+	expiry := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	expected := []UserGroup{{1, "sysop", nil}, {42, "bot", &expiry}, {7, "rollbacker", nil}}
+
+	next := UserGroups(strings.NewReader(userGroupsFixture))
+	var ugs []UserGroup
+	ug, err := next()
+	for ; err == nil; ug, err = next() {
+		ugs = append(ugs, ug)
+	}
+	if err != io.EOF {
+		t.Error("UserGroups iterator returns ", err)
+	}
+	if !reflect.DeepEqual(ugs, expected) {
+		t.Errorf("Rows should be %+v but they're %+v", expected, ugs)
+	}
+}
+
+const redirectFixture = "INSERT INTO `redirect` VALUES (10,0,'Computer_accessibility','',''),(13,0,'History_of_Afghanistan','','Early_history');\n"
+
+func TestRedirects(t *testing.T) {
+	expected := []Redirect{{10, 0, "Computer_accessibility", "", ""}, {13, 0, "History_of_Afghanistan", "", "Early_history"}}
+
+	next := Redirects(strings.NewReader(redirectFixture))
+	var rds []Redirect
+	rd, err := next()
+	for ; err == nil; rd, err = next() {
+		rds = append(rds, rd)
+	}
+	if err != io.EOF {
+		t.Error("Redirects iterator returns ", err)
+	}
+	if !reflect.DeepEqual(rds, expected) {
+		t.Errorf("Rows should be %+v but they're %+v", expected, rds)
+	}
+
+	if _, err := Redirects(strings.NewReader(userGroupsFixture))(); err == nil {
+		t.Error("Error should be not null")
+	}
+}
@@ -0,0 +1,52 @@
+package wikidump
+
+import (
+	"sync"
+	"time"
+)
+
+// Stats are the counters of the downloads of a wikidump and of all its copies, since its creation.
+type Stats struct {
+	Attempts         int64                    // download attempts, including the retries
+	Retries          int64                    // attempts following a failed one
+	Downloads        int64                    // downloads completed
+	BytesReceived    int64                    // bytes received, including the ones of failed attempts
+	ChecksumFailures int64                    // attempts failed for a checksum mismatch
+	DroppedEvents    int64                    // events other than Progress not received in time, see WithEvents
+	URL2Duration     map[string]time.Duration // wall-clock time of the completed downloads, retries included
+}
+
+// stats accumulates the counters of the downloads, a nil *stats counts nothing.
+type stats struct {
+	mu    sync.Mutex
+	stats Stats
+}
+
+func newStats() *stats {
+	return &stats{stats: Stats{URL2Duration: map[string]time.Duration{}}}
+}
+
+func (s *stats) update(update func(*Stats)) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(&s.stats)
+}
+
+// Stats returns a snapshot of the counters of the downloads of the wikidump, which are safe for concurrent downloads.
+// Wikidumps not created by the constructors of the package count nothing.
+func (w Wikidump) Stats() Stats {
+	if w.stats == nil {
+		return Stats{URL2Duration: map[string]time.Duration{}}
+	}
+	w.stats.mu.Lock()
+	defer w.stats.mu.Unlock()
+	snapshot := w.stats.stats
+	snapshot.URL2Duration = make(map[string]time.Duration, len(w.stats.stats.URL2Duration))
+	for url, duration := range w.stats.stats.URL2Duration {
+		snapshot.URL2Duration[url] = duration
+	}
+	return snapshot
+}
@@ -0,0 +1,40 @@
+package wikidump
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	server, _ := countingServer()
+	defer server.Close()
+
+	tDump := newWikidump("", "en", time.Now(), dumpStatus{})
+	tDump, err := tDump.With(WithRetryPolicy(2, time.Millisecond, time.Millisecond))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	info := name2MyInfo["/helloword.gz"]
+	r, err := tDump.open(context.Background(), fileInfo{URL: server.URL + "/helloword.gz", SHA1: info.SHA1})
+	if err != nil {
+		t.Fatal("open returns ", err)
+	}
+	r.Close()
+	tDump.open(context.Background(), fileInfo{URL: server.URL + "/helloword.bz2", SHA1: "wrong"})
+
+	stats := tDump.Stats()
+	expected := Stats{Attempts: 3, Retries: 1, Downloads: 1, ChecksumFailures: 2,
+		BytesReceived: int64(len(info.Data) + 2*len(name2MyInfo["/helloword.bz2"].Data))}
+	if duration, ok := stats.URL2Duration[server.URL+"/helloword.gz"]; !ok || duration <= 0 || len(stats.URL2Duration) != 1 {
+		t.Error("The duration of the completed download should be reported, while durations are ", stats.URL2Duration)
+	}
+	stats.URL2Duration = nil
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Stats should be %+v, while they're %+v", expected, stats)
+	}
+	if stats := (Wikidump{}).Stats(); stats.Attempts != 0 {
+		t.Error("A wikidump not created by the constructors should count nothing, while it counts ", stats)
+	}
+}
@@ -0,0 +1,105 @@
+package wikidump
+
+import (
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+// WithStreaming sets whether Open decompresses the resources while they're downloaded, without storing them first.
+// The checksum is computed in passing, so a mismatch is returned by the read reaching the end of the content, after
+// the content itself: what's read should be trusted only once the reader is depleted. Likewise an interrupted
+// download is returned by the reads, as it can't be retried. 7z archives, which need a file, files of the cache and
+// the parts stored ahead by WithShuffledParts and WithPrefetch are still stored first. By default it's disabled.
+func WithStreaming(enabled bool) Option {
+	return func(w *Wikidump) error {
+		w.streaming = enabled
+		return nil
+	}
+}
+
+// streams reports whether fi is decompressed while it's downloaded.
+func (w Wikidump) streams(fi fileInfo) bool {
+	return w.streaming && formatOf(fi.URL) != "7z" && w.cachePath(fi) == "" && w.revalidationPath(fi) == ""
+}
+
+// openStreaming decompresses fi while it's downloaded, verifying it once the decompressed content is depleted.
+// Only the request is retried.
+func (w Wikidump) openStreaming(ctx context.Context, fi fileInfo) (virtualFile, error) {
+	var body io.ReadCloser
+	err := w.stubbornly(ctx, fi.URL, func() (err error) {
+		body, _, err = w.streamWith(ctx, fi, nil)
+		return
+	})
+	if err != nil {
+		return virtualFile{}, err
+	}
+
+	_, algorithm, _ := fi.checksum()
+	h := algorithm.New()
+	verifier := &streamVerifier{io.TeeReader(body, h), h, ctx, w, fi}
+	r, err := w.decompress(ctx, virtualFile{verifier, body.Close, path.Base(fi.URL)}, fi)
+	if err != nil {
+		return virtualFile{}, err
+	}
+	r.Reader = &verifiedStream{Reader: r.Reader, verifier: verifier}
+	return r, nil
+}
+
+// streamVerifier hashes the download of fi as it's read.
+type streamVerifier struct {
+	io.Reader
+	hash hash.Hash
+	ctx  context.Context
+	w    Wikidump
+	fi   fileInfo
+}
+
+func (s *streamVerifier) Read(p []byte) (n int, err error) {
+	n, err = s.Reader.Read(p)
+	s.w.stats.update(func(stats *Stats) { stats.BytesReceived += int64(n) })
+	return
+}
+
+// check reads what's left of the download, as decompressors may stop before its end, and verifies its checksum.
+func (s *streamVerifier) check() error {
+	if _, err := io.Copy(ioutil.Discard, s); err != nil {
+		return errors.Wrap(err, "Error: unable to download the following url: "+s.fi.URL)
+	}
+	if !s.w.verifies(s.fi) {
+		return nil
+	}
+	if name, _, sum := s.fi.checksum(); fmt.Sprintf("%x", s.hash.Sum(nil)) != sum {
+		return errors.Wrap(ErrChecksumMismatch, "Error: mismatched "+name+" for the file downloaded from the following url: "+s.fi.URL)
+	}
+	s.w.emit(s.ctx, Event{Kind: Verified, URL: s.fi.URL})
+	return nil
+}
+
+// verifiedStream returns the decompressed content of a download, checking the download at its end.
+type verifiedStream struct {
+	io.Reader
+	verifier *streamVerifier
+	err      error
+}
+
+func (v *verifiedStream) Read(p []byte) (n int, err error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+	n, err = v.Reader.Read(p)
+	if err == io.EOF {
+		if checkErr := v.verifier.check(); checkErr != nil {
+			err = checkErr
+		}
+	}
+	if err != nil {
+		v.err = err
+	}
+	return
+}
@@ -0,0 +1,54 @@
+package wikidump
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestStreaming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(name2MyInfo[r.URL.Path].Data)
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tDump, err := Wikidump{tmpDir: dir}.With(WithStreaming(true), WithShouldRetry(func(error, int) bool { return false }))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	for _, name := range []string{"/helloword.gz", "/helloword.bz2"} {
+		r, err := tDump.open(context.Background(), fileInfo{URL: server.URL + name, SHA1: name2MyInfo[name].SHA1})
+		if err != nil {
+			t.Fatal("open returns ", err)
+		}
+		if infos, err := ioutil.ReadDir(dir); err != nil || len(infos) != 0 {
+			t.Error("Streamed files should not be stored, while there are ", len(infos), err)
+		}
+		if data, err := ioutil.ReadAll(r); err != nil || string(data) != helloword {
+			t.Error("Reading", name, "returns", string(data), err)
+		}
+		if err := r.Close(); err != nil {
+			t.Error("Closing returns ", err)
+		}
+	}
+
+	//the mismatch is returned at the end of the content
+	r, err := tDump.open(context.Background(), fileInfo{URL: server.URL + "/helloword.gz", SHA1: "wrong"})
+	if err != nil {
+		t.Fatal("open returns ", err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if string(data) != helloword || !errors.Is(err, ErrChecksumMismatch) {
+		t.Error("Reading should return the content and ErrChecksumMismatch, while it returns ", string(data), err)
+	}
+	r.Close()
+}
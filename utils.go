@@ -2,22 +2,59 @@ package wikidump
 
 import (
 	"bufio"
+	"bytes"
 	"compress/bzip2"
 	"compress/gzip"
+	"context"
 	"io"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
-	"github.com/kjk/lzmadec"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
 	"github.com/pkg/errors"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
 )
 
+var magic2Ext = []struct {
+	magic []byte
+	ext   string
+}{
+	{[]byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C}, ".7z"},
+	{[]byte("BZh"), ".bz2"},
+	{[]byte{0x1F, 0x8B}, ".gz"},
+	{[]byte{0x04, 0x22, 0x4D, 0x18}, ".lz4"},
+	{[]byte{0x28, 0xB5, 0x2F, 0xFD}, ".zst"},
+	{[]byte{0xFD, '7', 'z', 'X', 'Z', 0x00}, ".xz"},
+}
+
+// sniffExt returns the extension of the compression format of the content of r according to its magic bytes,
+// without consuming it.
+func sniffExt(r *bufio.Reader) string {
+	header, _ := r.Peek(6)
+	for _, m := range magic2Ext {
+		if bytes.HasPrefix(header, m.magic) {
+			return m.ext
+		}
+	}
+	return ""
+}
+
 func unGZip(ri virtualFile) (virtualFile, error) {
 	ro, err := gzip.NewReader(ri)
 	if err != nil {
 		ri.Close()
 		return virtualFile{}, err
 	}
+	ro.Multistream(true) //concatenated gzip members are read as a single file
 	return virtualFile{ro, func() error {
 		err1 := errors.Wrapf(ro.Close(), "Error while closing gzip reader of file %v", ri.Name())
 		err0 := ri.Close()
@@ -28,40 +65,131 @@ func unGZip(ri virtualFile) (virtualFile, error) {
 	}, ri.Name()}, nil
 }
 
+func unLz4(r virtualFile) (virtualFile, error) {
+	return virtualFile{lz4.NewReader(r), r.Close, r.Name()}, nil
+}
+
+func unZstd(ri virtualFile) (virtualFile, error) {
+	ro, err := zstd.NewReader(ri, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		ri.Close()
+		return virtualFile{}, err
+	}
+	return virtualFile{ro, func() error {
+		ro.Close()
+		return ri.Close()
+	}, ri.Name()}, nil
+}
+
+func unXz(r virtualFile) (virtualFile, error) {
+	ro, err := xz.NewReader(r)
+	if err != nil {
+		r.Close()
+		return virtualFile{}, err
+	}
+	return virtualFile{ro, r.Close, r.Name()}, nil
+}
+
+func unLzma(r virtualFile) (virtualFile, error) {
+	ro, err := lzma.NewReader(r)
+	if err != nil {
+		r.Close()
+		return virtualFile{}, err
+	}
+	return virtualFile{ro, r.Close, r.Name()}, nil
+}
+
 func unBZip2(r virtualFile) (virtualFile, error) {
 	return virtualFile{bzip2.NewReader(bufio.NewReader(r)), r.Close, r.Name()}, nil
 }
 
-func un7Zip(ri virtualFile) (ro virtualFile, err error) {
+//un7Zip extracts the only file in the archive ri. When ctx is done, the extraction is stopped and ri is closed
+//right away, even during a read, so that the resources of the archiver and the temporary file are released.
+func un7Zip(ctx context.Context, ri virtualFile, archiver Archiver, entryName string) (ro virtualFile, err error) {
 	fail := func(e error) (virtualFile, error) {
 		ri.Close()
 		ro, err = virtualFile{}, e
 		return ro, err
 	}
 
+	if archiver == nil {
+		archiver = &lzmadecArchiver{}
+	}
+
 	fname := ri.Name()
-	archive, err := lzmadec.NewArchive(fname)
+	entries, err := archiver.List(fname)
 	if err != nil {
-		return fail(errors.Wrapf(err, "%v while listing content of file %v", lzmadecErr2Meaning(err), fname))
+		return fail(err)
 	}
 
-	if len(archive.Entries) != 1 {
-		return fail(errors.Errorf("Error entries count differs from one - %v - for file %v", len(archive.Entries), fname))
+	entry, err := archiveEntry(entries, entryName, fname)
+	if err != nil {
+		return fail(err)
 	}
 
-	r, err := archive.GetFileReader(archive.Entries[0].Path)
+	r, err := archiver.Open(fname, entry)
 	if err != nil {
-		return fail(errors.Wrapf(err, "%v while opening file %v", lzmadecErr2Meaning(err), fname))
+		return fail(err)
 	}
 
-	return virtualFile{r, func() error {
-		err1 := errors.Wrapf(r.Close(), "Error while closing 7zip reader of file %v", fname)
-		err0 := ri.Close()
-		if err1 != nil {
-			return err1
+	var once sync.Once
+	var closeErr error
+	closed := make(chan struct{})
+	closer := func() error {
+		once.Do(func() {
+			close(closed)
+			err1 := errors.Wrapf(r.Close(), "Error while closing 7zip reader of file %v", fname)
+			err0 := ri.Close()
+			if closeErr = err1; closeErr == nil {
+				closeErr = err0
+			}
+		})
+		return closeErr
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			closer()
+		case <-closed:
 		}
-		return err0
-	}, ri.Name()}, nil
+	}()
+
+	return virtualFile{&contextReader{ctx, r}, closer, ri.Name()}, nil
+}
+
+//contextReader fails reads once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (n int, err error) {
+	if err = c.ctx.Err(); err != nil {
+		return 0, errors.Wrap(err, "Error: change in context state")
+	}
+	if n, err = c.r.Read(p); err != nil && err != io.EOF && c.ctx.Err() != nil {
+		err = errors.Wrap(c.ctx.Err(), "Error: change in context state")
+	}
+	return
+}
+
+// archiveEntry returns the entry to extract from the archive fname: the one named name if set, otherwise the only one.
+// The errors list the entries available.
+func archiveEntry(entries []Entry, name, fname string) (Entry, error) {
+	paths := make([]string, len(entries))
+	for i, e := range entries {
+		if name != "" && (e.Path == name || filepath.Base(e.Path) == name) {
+			return e, nil
+		}
+		paths[i] = e.Path
+	}
+	switch {
+	case name != "":
+		return Entry{}, errors.Errorf("Error entry %v not found in file %v, whose entries are: %v", name, fname, strings.Join(paths, ", "))
+	case len(entries) != 1:
+		return Entry{}, errors.Errorf("Error entries count differs from one - %v - for file %v, whose entries are: %v", len(entries), fname, strings.Join(paths, ", "))
+	}
+	return entries[0], nil
 }
 
 func lzmadecErr2Meaning(err error) (defaultM string) {
@@ -102,6 +230,59 @@ var code2Meaning = map[int]string{
 	255: "User stopped the process",
 }
 
+// ErrIdleTimeout is returned when a download doesn't receive any byte for longer than the idle timeout.
+var ErrIdleTimeout = errors.New("idle timeout")
+
+// idleTimeout cancels a download when its reader doesn't receive any byte within timeout,
+// a nil *idleTimeout disables the timeout.
+type idleTimeout struct {
+	timer   *time.Timer
+	timeout time.Duration
+	fired   int32
+}
+
+func newIdleTimeout(timeout time.Duration, cancel context.CancelFunc) *idleTimeout {
+	t := &idleTimeout{timeout: timeout}
+	t.timer = time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&t.fired, 1)
+		cancel()
+	})
+	return t
+}
+
+// Reader returns a reader that resets the timeout each time it receives some byte.
+func (t *idleTimeout) Reader(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return idleTimeoutReader{r, t}
+}
+
+// Check replaces err with ErrIdleTimeout if the timeout expired.
+func (t *idleTimeout) Check(err error, url string) error {
+	if t != nil && err != nil && atomic.LoadInt32(&t.fired) == 1 {
+		return errors.Wrap(ErrIdleTimeout, "Error: no data received from the following url: "+url)
+	}
+	return err
+}
+
+func (t *idleTimeout) Stop() {
+	t.timer.Stop()
+}
+
+type idleTimeoutReader struct {
+	r io.Reader
+	t *idleTimeout
+}
+
+func (r idleTimeoutReader) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	if n > 0 {
+		r.t.timer.Reset(r.t.timeout)
+	}
+	return
+}
+
 type virtualFile struct {
 	io.Reader
 	Closer func() error
@@ -115,3 +296,42 @@ func (f virtualFile) Close() error {
 func (f virtualFile) Name() string {
 	return f.name
 }
+
+// rename is os.Rename, it's a variable so that tests can simulate moves across filesystems.
+var rename = os.Rename
+
+// moveFile moves src to dst. When they are on different filesystems, where a rename fails, src is copied
+// into a temporary file next to dst, that is then renamed to dst, and src is removed. The temporary file is
+// prefixed by ".tmp-", so that it never matches the names of the files it's going to become, as the ones in the cache.
+func moveFile(src, dst string) error {
+	err := rename(src, dst)
+	if linkErr, ok := err.(*os.LinkError); !ok || linkErr.Err != syscall.EXDEV {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return errors.Wrap(err, "Error: unable to open the following file: "+src)
+	}
+	defer in.Close()
+
+	out, err := ioutil.TempFile(filepath.Dir(dst), ".tmp-"+filepath.Base(dst))
+	if err != nil {
+		return errors.Wrap(err, "Error: unable to create temporary file in "+filepath.Dir(dst))
+	}
+	fail := func(e error) error {
+		out.Close()
+		os.Remove(out.Name())
+		return e
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		return fail(errors.Wrap(err, "Error: unable to copy the following file: "+src))
+	}
+	if err = out.Close(); err != nil {
+		return fail(errors.Wrap(err, "Error: unable to close the following file: "+out.Name()))
+	}
+	if err = rename(out.Name(), dst); err != nil {
+		return fail(err)
+	}
+	return errors.Wrap(os.Remove(src), "Error: unable to remove the following file: "+src)
+}
@@ -2,15 +2,24 @@
 package wikidump
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"crypto/sha1"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
@@ -18,38 +27,443 @@ import (
 
 // Wikidump represent a hub from which request particular dump files of wikipedia.
 type Wikidump struct {
-	file2Info map[string][]fileInfo
-	tmpDir    string
-	date      time.Time
+	file2Info      map[string][]fileInfo
+	tmpDir         string
+	lang           string
+	date           time.Time
+	reportedSize   int64
+	scanBuffer     int
+	spillThreshold int64
+	memory         *memoryBudget
+	cacheDir       string
+	shuffleParts   bool
+	sniffing       bool
+	strictSniffing bool
+	logger         Logger
+	beforeAttempt  func(ctx context.Context, url string, attempt int) error
+	shouldRetry    func(err error, attempt int) bool
+	idleTimeout    time.Duration
+	headersFor     func(url string) http.Header
+	trafficLog     bool
+	verifyWorkers  int
+	events         chan<- Event
+	gzipSize       func(url string) (size int64, ok bool)
+	graceFraction  float64
+	grace          time.Duration
+	archiver       Archiver
+	roundTrippers  []func(http.RoundTripper) http.RoundTripper
+	transport      http.RoundTripper
+	segments       int
+	mirrors        []string
+	probeMirrors   bool
+	ranked         []string
+	filter         func(io.Reader) io.Reader
+	redirectHosts  map[string]bool
+	progress       *downloadProgress
+	materialized   *materialized
+	contentCheck   bool
+	userAgent      string
+	fetcher        func(ctx context.Context, url string) (io.ReadCloser, http.Header, error)
+	verifyOnDisk   bool
+	progressFunc   func(filename string, done, total int64)
+	retryPolicy    retryPolicy
+	jitter         *jitter
+	prefetch       int
+	job2Status     map[string]string
+	skipChecksums  bool
+	archiveEntry   string
+	httpClient     *http.Client
+	streaming      bool
+	ownedTmpDir    string
+	stats          *stats
+	mirror         string
+	rateLimiter    *rateLimiter
+	streamIndexes  *streamIndexes
 }
 
 type fileInfo struct {
-	URL, SHA1 string
+	URL              string `json:"url"`
+	SHA1             string `json:"sha1"`
+	Size             int64  `json:"size,omitempty"`
+	UncompressedSize int64  `json:"uncompressed_size,omitempty"` //reported only by some mirrors
+	SHA256           string `json:"sha256,omitempty"`            //preferred to SHA1 when known, see WithSHA256Sums
+	MD5              string `json:"md5,omitempty"`               //used when there's no SHA1, see WithMD5Sums
 }
 
-//CheckFor checks for file existence in the wikidump
+//ErrFileNotFound is returned when a requested filename is not available in the wikidump.
+var ErrFileNotFound = errors.New("file not found")
+
+//ErrHostNotFound is returned when the host of a url doesn't exist, downloads from such hosts are not retried.
+var ErrHostNotFound = errors.New("host not found")
+
+//ErrDisallowedRedirect is returned when a download is redirected to a host out of the allowlist set by
+//WithRedirectAllowlist, such downloads are not retried.
+var ErrDisallowedRedirect = errors.New("disallowed redirect")
+
+//ErrTruncated is returned when a download ends before the length declared by its Content-Length header,
+//such downloads are retried.
+var ErrTruncated = errors.New("truncated download")
+
+//ErrFormatMismatch is returned when the content of a file contradicts its extension and WithStrictSniffing is enabled.
+var ErrFormatMismatch = errors.New("compression format mismatch")
+
+//CheckFor checks for file existence in the wikidump, if some files are missing it returns an error wrapping ErrFileNotFound
+//that lists all of them.
 func (w Wikidump) CheckFor(filenames ...string) error {
+	var missing []string
 	for _, filename := range filenames {
 		if _, ok := w.file2Info[filename]; !ok {
-			return errors.New(filename + " not found")
+			missing = append(missing, filename)
 		}
 	}
+	if len(missing) > 0 {
+		return errors.Wrap(ErrFileNotFound, strings.Join(missing, ", "))
+	}
 	return nil
 }
 
+//Files returns the sorted list of the filenames available in the wikidump, which can be passed to Open.
+func (w Wikidump) Files() []string {
+	filenames := make([]string, 0, len(w.file2Info))
+	for filename := range w.file2Info {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	return filenames
+}
+
+//Match returns the sorted list of the filenames matching the shell pattern, in the syntax of path.Match, either
+//by themselves or by the name of one of their resources, as "*pages-articles[0-9]*" for the parts of articlesdump.
+func (w Wikidump) Match(pattern string) ([]string, error) {
+	var filenames []string
+	for _, filename := range w.Files() {
+		matched, err := path.Match(pattern, filename)
+		for _, fi := range w.file2Info[filename] {
+			if matched || err != nil {
+				break
+			}
+			matched, err = path.Match(pattern, path.Base(fi.URL))
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Error: invalid pattern "+pattern)
+		}
+		if matched {
+			filenames = append(filenames, filename)
+		}
+	}
+	return filenames, nil
+}
+
+//sortedKeys returns the sorted keys of m.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//Status returns the status of the job producing filename in the index, such as "done", "in-progress", "waiting"
+//or "failed". Only the files of the jobs done are available, but the status is returned for any job in the index.
+func (w Wikidump) Status(filename string) (string, error) {
+	status, ok := w.job2Status[filename]
+	if !ok {
+		return "", errors.Wrap(ErrFileNotFound, filename)
+	}
+	return status, nil
+}
+
+//ErrIncompleteDump is returned by CheckComplete when some jobs of the dump are not done.
+var ErrIncompleteDump = errors.New("incomplete dump")
+
+//CheckComplete checks that all the jobs in the index are done, otherwise it returns an error wrapping ErrIncompleteDump
+//that lists the other ones with their status. It allows pipelines to reject partial dumps right after creating them.
+func (w Wikidump) CheckComplete() error {
+	var pending []string
+	for _, job := range sortedKeys(w.job2Status) {
+		if status := w.job2Status[job]; status != "done" {
+			pending = append(pending, job+" ("+status+")")
+		}
+	}
+	if len(pending) > 0 {
+		return errors.Wrap(ErrIncompleteDump, strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+//URLs returns the ordered list of the URLs of the resources associated with filename.
+func (w Wikidump) URLs(filename string) ([]string, error) {
+	if err := w.CheckFor(filename); err != nil {
+		return nil, err
+	}
+	ffi := w.file2Info[filename]
+	urls := make([]string, len(ffi))
+	for i, fi := range ffi {
+		urls[i] = fi.URL
+	}
+	return urls, nil
+}
+
+//FileInfo describes a resource of the wikidump as reported by the index, sizes are zero when not reported.
+type FileInfo struct {
+	URL              string
+	SHA1             string
+	SHA256           string
+	MD5              string
+	Size             int64
+	UncompressedSize int64
+}
+
+//Info returns the ordered list of the descriptions of the resources associated with filename.
+func (w Wikidump) Info(filename string) ([]FileInfo, error) {
+	if err := w.CheckFor(filename); err != nil {
+		return nil, err
+	}
+	ffi := w.file2Info[filename]
+	infos := make([]FileInfo, len(ffi))
+	for i, fi := range ffi {
+		infos[i] = FileInfo{fi.URL, fi.SHA1, fi.SHA256, fi.MD5, fi.Size, fi.UncompressedSize}
+	}
+	return infos, nil
+}
+
+//Plan returns the ordered list of the descriptions of the resources Open would download for filename, without
+//downloading anything: it's Info with the URLs of the preferred mirror, if any, as for feeding external downloaders.
+//If WithProbeMirrors is enabled, the mirrors are probed first to pick the preferred one.
+func (w Wikidump) Plan(filename string) ([]FileInfo, error) {
+	infos, err := w.Info(filename)
+	for i := range infos {
+		infos[i].URL = w.mirrorURL(infos[i].URL)
+	}
+	return infos, err
+}
+
+//ExpectedSHA1 returns the SHA1 sum in the index of the resource of filename, so that files held externally can be verified
+//without downloading them. It fails for files made of several resources, whose sums are returned by ExpectedSHA1s.
+func (w Wikidump) ExpectedSHA1(filename string) (string, error) {
+	if err := w.CheckFor(filename); err != nil {
+		return "", err
+	}
+	ffi := w.file2Info[filename]
+	if len(ffi) != 1 {
+		return "", errors.Errorf("Error: %v is made of %v resources, see ExpectedSHA1s", filename, len(ffi))
+	}
+	return ffi[0].SHA1, nil
+}
+
+//ExpectedSHA1s returns the SHA1 sums in the index of all the resources, keyed by the base name of their URL.
+func (w Wikidump) ExpectedSHA1s() map[string]string {
+	name2SHA1 := make(map[string]string)
+	for _, ffi := range w.file2Info {
+		for _, fi := range ffi {
+			name2SHA1[path.Base(fi.URL)] = fi.SHA1
+		}
+	}
+	return name2SHA1
+}
+
+//DecompressorFor returns the name of the decompressor that would be used for the resources associated with filename,
+//named as in Formats. If sniffing is enabled, the first bytes of the first resource are requested to detect its format.
+func (w Wikidump) DecompressorFor(filename string) (string, error) {
+	if err := w.CheckFor(filename); err != nil {
+		return "", err
+	}
+	fi := w.file2Info[filename][0]
+	format := formatOf(fi.URL)
+	if w.sniffing {
+		header, err := w.peek(context.Background(), fi, 6)
+		if err != nil {
+			return "", err
+		}
+		if sniffed := formatOf(sniffExt(bufio.NewReader(bytes.NewReader(header)))); sniffed != "" && sniffed != format {
+			if w.strictSniffing {
+				return "", errors.Wrapf(ErrFormatMismatch, "%v content of the file downloaded from the following url: %v", sniffed, fi.URL)
+			}
+			format = sniffed
+		}
+	}
+	if format == "" {
+		format = "none"
+	}
+	return format, nil
+}
+
+//EstimateDecompressedSize returns the size in bytes of the decompressed content of all the resources associated with filename,
+//and whether it's exact. It's exact if the uncompressed sizes in the index are available for all the resources, otherwise
+//it's an estimate based on the compressed size and a typical compression ratio for the format of each resource, see format2Ratio.
+func (w Wikidump) EstimateDecompressedSize(filename string) (size int64, exact bool, err error) {
+	if err := w.CheckFor(filename); err != nil {
+		return 0, false, err
+	}
+	exact = true
+	for _, fi := range w.file2Info[filename] {
+		switch {
+		case fi.UncompressedSize > 0:
+			size += fi.UncompressedSize
+		case fi.Size > 0:
+			ratio, ok := format2Ratio[formatOf(fi.URL)]
+			if !ok {
+				ratio = 1
+			}
+			size += fi.Size * ratio
+			exact = false
+		default:
+			return 0, false, errors.New("Error: no size in the index for the following url: " + fi.URL)
+		}
+	}
+	return size, exact, nil
+}
+
+//format2Ratio maps each format to the typical ratio between the decompressed and the compressed size of a dump.
+var format2Ratio = map[string]int64{"7z": 30, "bzip2": 6, "gzip": 4, "lz4": 3, "zstd": 5, "xz": 8, "lzma": 8, "": 1}
+
 //Date returns the date of the current Dump
 func (w Wikidump) Date() time.Time {
 	return w.date
 }
 
+//Formats returns how many files of the wikidump use each compression format, according to their extension.
+//Formats are named "7z", "bzip2", "gzip", "lz4", "zstd", "xz", "lzma" and "none" for uncompressed files,
+//the ones of RegisterDecompressor after their extension.
+func (w Wikidump) Formats() map[string]int {
+	format2Count := map[string]int{}
+	for _, ffi := range w.file2Info {
+		for _, fi := range ffi {
+			format := formatOf(fi.URL)
+			if format == "" {
+				format = "none"
+			}
+			format2Count[format]++
+		}
+	}
+	return format2Count
+}
+
+//TotalDumpSize returns the sum of the sizes of all the files in the wikidump, as reported by the index.
+func (w Wikidump) TotalDumpSize() (size int64) {
+	for _, ffi := range w.file2Info {
+		for _, fi := range ffi {
+			size += fi.Size
+		}
+	}
+	return
+}
+
+//ErrUnknownSize is returned by TotalSize when the index doesn't report the size of some resources.
+var ErrUnknownSize = errors.New("unknown size")
+
+//TotalSize returns the sum of the sizes of all the resources associated with filenames, as reported by the index.
+//If the size of some resources is not reported, it returns the sum of the known ones along with an error wrapping ErrUnknownSize.
+func (w Wikidump) TotalSize(filenames ...string) (size int64, err error) {
+	if err = w.CheckFor(filenames...); err != nil {
+		return 0, err
+	}
+	var unknown []string
+	for _, filename := range filenames {
+		for _, fi := range w.file2Info[filename] {
+			if fi.Size <= 0 {
+				unknown = append(unknown, fi.URL)
+			}
+			size += fi.Size
+		}
+	}
+	if len(unknown) > 0 {
+		err = errors.Wrapf(ErrUnknownSize, "Error: no size reported for the following urls: %v", strings.Join(unknown, ", "))
+	}
+	return
+}
+
+//VerifyTotalSize compares TotalDumpSize with the aggregate size reported by the index, if any,
+//returning an error on mismatch: that is the sign of an incomplete index.
+func (w Wikidump) VerifyTotalSize() error {
+	if w.reportedSize == 0 {
+		return errors.New("Error: the index doesn't report an aggregate size")
+	}
+	if size := w.TotalDumpSize(); size != w.reportedSize {
+		return errors.Errorf("Error: the files sum up to %v bytes, while the index reports %v bytes", size, w.reportedSize)
+	}
+	return nil
+}
+
+//UncompressedSHA1 returns the SHA1 sum of the decompressed content of all the resources associated with filename,
+//it allows to compare the same content compressed in different formats.
+func (w Wikidump) UncompressedSHA1(ctx context.Context, filename string) (string, error) {
+	if err := w.CheckFor(filename); err != nil {
+		return "", err
+	}
+	r := w.openAll(ctx, filename)
+	defer r.Close()
+
+	hash := sha1.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", errors.Wrap(err, "Error: unable to read the content of "+filename)
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+//SameRun reports whether the two wikidumps refer to the same dump run, that is they share date, language
+//and the SHA1 sums of all their files, regardless of the path they were fetched through.
+func (w Wikidump) SameRun(other *Wikidump) bool {
+	if other == nil || !w.date.Equal(other.date) || w.lang != other.lang || len(w.file2Info) != len(other.file2Info) {
+		return false
+	}
+	for filename, ffi := range w.file2Info {
+		offi, ok := other.file2Info[filename]
+		if !ok || len(ffi) != len(offi) {
+			return false
+		}
+		sha1s := map[string]int{}
+		for i := range ffi {
+			sha1s[ffi[i].SHA1]++
+			sha1s[offi[i].SHA1]--
+		}
+		for _, count := range sha1s {
+			if count != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 //Open returns an iterator over the resources associated with the current filename,
 //the download can be stopped by the context. Once the iterator is depleted, it returns an io.EOF error.
 //Once an error is returned by the iterator, any subsequent call will return the same error.
 //It is the caller's responsibility to call Close on the Reader when done.
 //Open takes care of checking SHA1 sum, retry download and decompressing files.
+//If WithShuffledParts is enabled, the first call downloads all the resources in random order,
+//so the iterator should be depleted to release them. The same holds for the parts downloaded ahead with WithPrefetch.
+//The iterator can be called from multiple goroutines, the calls are serialized so that each resource is returned once.
 func (w Wikidump) Open(filename string) func(context.Context) (io.ReadCloser, error) {
+	next, _ := w.openParts(filename)
+	return next
+}
+
+//openParts returns the iterator of Open along with a function releasing the parts stored ahead, if any,
+//after which the iterator returns an error. The downloads of the parts ahead should be cancelled before releasing them.
+func (w Wikidump) openParts(filename string) (next func(context.Context) (io.ReadCloser, error), release func()) {
 	ffi, err := w.file2Info[filename], w.CheckFor(filename)
-	return func(ctx context.Context) (io.ReadCloser, error) {
+	var stored []virtualFile
+	var prefetch *prefetcher
+	if w.prefetch > 0 && !w.shuffleParts {
+		prefetch = &prefetcher{w: w, ffi: ffi}
+	}
+	var mu sync.Mutex
+	release = func() {
+		mu.Lock()
+		defer mu.Unlock()
+		closeAll(stored)
+		if prefetch != nil {
+			prefetch.release()
+		}
+		if stored, ffi = nil, nil; err == nil {
+			err = errors.New("Error: the parts have been released")
+		}
+	}
+	next = func(ctx context.Context) (io.ReadCloser, error) {
+		mu.Lock()
+		defer mu.Unlock()
 		if err != nil {
 			return nil, err
 		}
@@ -57,48 +471,366 @@ func (w Wikidump) Open(filename string) func(context.Context) (io.ReadCloser, er
 			err = io.EOF
 			return nil, err
 		}
+		if stored != nil && ctx.Err() != nil { //the parts stored ahead don't survive the cancellation
+			closeAll(stored)
+			stored, err = nil, ctx.Err()
+			return nil, err
+		}
+		if w.shuffleParts && stored == nil {
+			if stored, err = w.storeShuffled(ctx, ffi); err != nil {
+				return nil, err
+			}
+		}
 		var r io.ReadCloser
-		r, err = w.open(ctx, ffi[0])
+		if stored != nil {
+			r, err = w.decompress(ctx, stored[0], ffi[0])
+			if stored = stored[1:]; err != nil {
+				closeAll(stored)
+			}
+		} else if prefetch != nil {
+			var part virtualFile
+			if part, err = prefetch.next(ctx); err == nil {
+				if r, err = w.decompress(ctx, part, ffi[0]); err != nil {
+					prefetch.discard()
+				}
+			}
+		} else {
+			r, err = w.open(ctx, ffi[0])
+		}
 		ffi = ffi[1:]
 		return r, err
 	}
+	return
 }
 
-func (w Wikidump) open(ctx context.Context, fi fileInfo) (r virtualFile, err error) {
-	r, err = w.stubbornStore(ctx, fi)
-	switch {
-	case err != nil:
-		//do nothing
-	case strings.HasSuffix(fi.URL, ".7z"):
-		r, err = un7Zip(r)
-	case strings.HasSuffix(fi.URL, ".bz2"):
-		r, err = unBZip2(r)
-	case strings.HasSuffix(fi.URL, ".gz"):
-		r, err = unGZip(r)
+//OpenNamed is like Open, but its iterator returns also the url of the resource of each reader.
+//When the iterator returns an error, the url is the one of the resource that failed, if any.
+func (w Wikidump) OpenNamed(filename string) func(context.Context) (string, io.ReadCloser, error) {
+	next, ffi := w.Open(filename), w.file2Info[filename]
+	var url string
+	var failed error
+	var mu sync.Mutex
+	return func(ctx context.Context) (string, io.ReadCloser, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failed != nil {
+			return url, nil, failed
+		}
+		r, err := next(ctx)
+		if url = ""; err != io.EOF && len(ffi) > 0 {
+			url, ffi = ffi[0].URL, ffi[1:]
+		}
+		failed = err
+		return url, r, err
 	}
+}
 
+//storeShuffled stores the resources associated with ffi in random order, returning them in logical order.
+func (w Wikidump) storeShuffled(ctx context.Context, ffi []fileInfo) (stored []virtualFile, err error) {
+	stored = make([]virtualFile, len(ffi))
+	for _, i := range rand.Perm(len(ffi)) {
+		if stored[i], err = w.stubbornStore(ctx, ffi[i]); err != nil {
+			closeAll(stored)
+			return nil, err
+		}
+	}
 	return
 }
 
+func closeAll(stored []virtualFile) {
+	for _, r := range stored {
+		if r.Closer != nil {
+			r.Close()
+		}
+	}
+}
+
+//OpenDecompressedRange returns a reader over the bytes in [start, end) of the decompressed content of all the resources
+//associated with filename, the preceding bytes are decompressed and discarded. It allows to share the processing of
+//a single file across workers. It is the caller's responsibility to call Close on the Reader when done.
+func (w Wikidump) OpenDecompressedRange(ctx context.Context, filename string, start, end int64) (io.ReadCloser, error) {
+	if start < 0 || end < start {
+		return nil, errors.Errorf("Error: invalid range [%v, %v)", start, end)
+	}
+	if err := w.CheckFor(filename); err != nil {
+		return nil, err
+	}
+
+	r := w.openAll(ctx, filename)
+	if _, err := io.CopyN(ioutil.Discard, r, start); err != nil && err != io.EOF {
+		r.Close()
+		return nil, errors.Wrap(err, "Error: unable to skip to the start of the range of "+filename)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(r, end-start), r}, nil
+}
+
+//OpenAll returns a single reader over the decompressed content of all the resources associated with filename, in order.
+//Each resource is downloaded only once the previous one is depleted, the reader returns io.EOF only after the last one
+//and any error of a resource is returned by the reader. It is the caller's responsibility to call Close when done,
+//which also releases the parts stored ahead with WithShuffledParts or WithPrefetch.
+func (w Wikidump) OpenAll(ctx context.Context, filename string) (io.ReadCloser, error) {
+	if err := w.CheckFor(filename); err != nil {
+		return nil, err
+	}
+	return w.openAll(ctx, filename), nil
+}
+
+//openAll returns a reader over the concatenation of the resources associated with filename,
+//each resource is opened only once the previous one is depleted.
+//Closing it releases the parts stored ahead, if any.
+func (w Wikidump) openAll(ctx context.Context, filename string) io.ReadCloser {
+	ctx, cancel := context.WithCancel(ctx)
+	next, release := w.openParts(filename)
+	return &multiPart{ctx: ctx, next: next, release: func() { cancel(); release() }}
+}
+
+type multiPart struct {
+	ctx     context.Context
+	next    func(context.Context) (io.ReadCloser, error)
+	release func()
+	current io.ReadCloser
+	err     error
+}
+
+func (m *multiPart) Read(p []byte) (n int, err error) {
+	for m.err == nil {
+		if m.current == nil {
+			if m.current, m.err = m.next(m.ctx); m.err != nil {
+				m.current = nil
+			}
+			continue
+		}
+
+		n, err = m.current.Read(p)
+		switch {
+		case err == io.EOF:
+			m.err = m.current.Close()
+			m.current = nil
+		case err != nil:
+			m.err = err
+		}
+		if n > 0 || m.err != nil {
+			return n, m.err
+		}
+	}
+	return 0, m.err
+}
+
+func (m *multiPart) Close() (err error) {
+	if m.current != nil {
+		err = m.current.Close()
+		m.current = nil
+	}
+	m.release()
+	if m.err == nil {
+		m.err = errors.New("Error: read on closed reader")
+	}
+	return
+}
+
+func (w Wikidump) open(ctx context.Context, fi fileInfo) (r virtualFile, err error) {
+	if w.streams(fi) {
+		return w.openStreaming(ctx, fi)
+	}
+	if r, err = w.stubbornStore(ctx, fi); err != nil {
+		return
+	}
+	ctx, cancel := w.graceAfterDownload(ctx, fi)
+	if r, err = w.decompress(ctx, r, fi); err != nil {
+		cancel()
+		return
+	}
+	closer := r.Closer
+	r.Closer = func() error {
+		defer cancel()
+		return closer()
+	}
+	return
+}
+
+func (w Wikidump) decompress(ctx context.Context, r virtualFile, fi fileInfo) (virtualFile, error) {
+	d, ok := lookup(fi.URL)
+	if w.sniffing {
+		br := bufio.NewReader(r.Reader)
+		r.Reader = br
+		if sniffed, found := lookup(sniffExt(br)); found && sniffed.format != d.format {
+			if w.strictSniffing {
+				r.Close()
+				return virtualFile{}, errors.Wrapf(ErrFormatMismatch, "%v content of the file downloaded from the following url: %v", sniffed.format, fi.URL)
+			}
+			w.logf("Warning: %v content of the file downloaded from the following url: %v, proceeding with %v", sniffed.format, redactURL(fi.URL), sniffed.format)
+			d, ok = sniffed, true
+		}
+	}
+
+	w.logf("Decompressing the following url: %v as %v", redactURL(fi.URL), d.format)
+	var err error
+	if ok {
+		r, err = d.decompress(ctx, w, r)
+	}
+
+	if err == nil && w.contentCheck {
+		r, err = checkContent(r, fi)
+	}
+	if err == nil && w.filter != nil {
+		r.Reader = w.filter(r.Reader)
+	}
+	return r, err
+}
+
 func (w Wikidump) stubbornStore(ctx context.Context, fi fileInfo) (r virtualFile, err error) {
-	for t := time.Second; t < time.Hour; t = t * 2 { //exponential backoff
-		if r, err = w.store(ctx, fi); err == nil {
+	if r, ok := w.cached(fi); ok {
+		if w.verifyOnDisk {
+			if err = w.verifyStored(r.name, fi); err != nil {
+				r.Close()
+				return virtualFile{}, errors.Wrap(err, "Error: cached file failed verification, see RepairCache")
+			}
+		}
+		return r, nil
+	}
+	mirrors := w.failover(fi)
+	for i, mirror := range mirrors {
+		w.mirror = mirror
+		if r, err = w.stubbornStoreFrom(ctx, fi); err == nil || ctx.Err() != nil {
 			return
 		}
+		if i+1 < len(mirrors) {
+			w.logf("Warning: unable to download the following url: %v from %v, failing over to %v", redactURL(fi.URL), mirror, mirrors[i+1])
+		}
+	}
+	return
+}
+
+//stubbornStoreFrom stores fi downloading it from w.mirror, if set.
+func (w Wikidump) stubbornStoreFrom(ctx context.Context, fi fileInfo) (r virtualFile, err error) {
+	if w.revalidationPath(fi) != "" {
+		err = w.stubbornly(ctx, fi.URL, func() (err error) {
+			r, err = w.revalidate(ctx, fi)
+			return
+		})
+		return
+	}
+	var partial string //the temporary file of a failed attempt, resumed by the next one
+	err = w.stubbornly(ctx, fi.URL, func() (err error) {
+		r, err = w.store(ctx, fi, &partial)
+		return
+	})
+	if err != nil {
+		r = virtualFile{}
+	}
+	if partial != "" {
+		os.Remove(partial)
+	}
+	return
+}
+
+//stubbornly retries attempt at downloading url with exponential backoff until it succeeds, the context is done
+//or the retries are exhausted. Each wait is drawn at random up to the backoff, so that concurrent downloads don't retry
+//in lockstep. When the server requests a wait with Retry-After, it's used in place of the backoff.
+func (w Wikidump) stubbornly(ctx context.Context, url string, attempt func() error) (err error) {
+	policy, start := w.retryPolicy.orDefault(), time.Now()
+	for t, i := policy.initialDelay, 1; ; t, i = policy.next(t), i+1 { //exponential backoff
+		if w.beforeAttempt != nil {
+			if hookErr := w.beforeAttempt(ctx, url, i); hookErr != nil {
+				return errors.Wrap(hookErr, "Error: download aborted for the following url: "+url)
+			}
+		}
+		w.emit(ctx, Event{Kind: Started, URL: url, Attempt: i})
+		w.logf("Attempt %v at downloading the following url: %v", i, redactURL(url))
+		w.stats.update(func(s *Stats) {
+			if s.Attempts++; i > 1 {
+				s.Retries++
+			}
+		})
+		if err = attempt(); err == nil {
+			w.emit(ctx, Event{Kind: Completed, URL: url})
+			w.stats.update(func(s *Stats) { s.Downloads, s.URL2Duration[url] = s.Downloads+1, time.Since(start) })
+			return
+		}
+		if errors.Is(err, ErrChecksumMismatch) {
+			w.stats.update(func(s *Stats) { s.ChecksumFailures++ })
+		}
+		w.emit(ctx, Event{Kind: Failed, URL: url, Attempt: i, Err: err})
+		if i >= policy.maxAttempts || !w.retriable(err, i) {
+			return
+		}
+		wait := w.jitter.delay(t)
+		if requested := retryAfter(err); requested > 0 {
+			wait = requested
+		}
+		w.logf("Warning: attempt %v failed for the following url: %v, retrying in %v", i, redactURL(url), wait)
 		select {
 		case <-ctx.Done():
-			return virtualFile{}, errors.Wrap(ctx.Err(), "Error: change in context state")
-		case <-time.After(t):
+			return errors.Wrap(ctx.Err(), "Error: change in context state")
+		case <-time.After(wait):
 			//do nothing
 		}
 	}
-	return
 }
 
-func (w Wikidump) store(ctx context.Context, fi fileInfo) (r virtualFile, err error) {
-	tempFile, err := ioutil.TempFile(w.tmpDir, path.Base(fi.URL))
+//retryPolicy bounds the attempts of stubbornly, the zero value stands for the default one.
+type retryPolicy struct {
+	maxAttempts            int
+	initialDelay, maxDelay time.Duration
+}
+
+//defaultRetryPolicy makes up to 12 attempts, waiting from one second up to 17 minutes between them.
+var defaultRetryPolicy = retryPolicy{12, time.Second, time.Hour}
+
+func (p retryPolicy) orDefault() retryPolicy {
+	if p == (retryPolicy{}) {
+		return defaultRetryPolicy
+	}
+	return p
+}
+
+//jitter draws the random waits of the backoff, it's safe for concurrent use.
+type jitter struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func newJitter(seed int64) *jitter {
+	return &jitter{rand: rand.New(rand.NewSource(seed))}
+}
+
+//delay returns a random duration in [0, t), drawn from the global source if j is nil.
+func (j *jitter) delay(t time.Duration) time.Duration {
+	if t <= 0 {
+		return 0
+	}
+	if j == nil {
+		return time.Duration(rand.Int63n(int64(t)))
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return time.Duration(j.rand.Int63n(int64(t)))
+}
+
+//next returns the delay following t, doubling it up to the maximum delay.
+func (p retryPolicy) next(t time.Duration) time.Duration {
+	if t *= 2; t > p.maxDelay {
+		t = p.maxDelay
+	}
+	return t
+}
+
+//store downloads the resource associated with fi, resuming the download in partial, if any. If the attempt fails
+//and the download can be resumed, partial is set to the temporary file with the bytes received.
+func (w Wikidump) store(ctx context.Context, fi fileInfo, partial *string) (r virtualFile, err error) {
+	if 0 < fi.Size && fi.Size <= w.spillThreshold && formatOf(fi.URL) != "7z" && w.memory.fits(fi.Size) && w.cachePath(fi) == "" {
+		if r, err = w.storeInMemory(ctx, fi); errors.Cause(err) != errOversized {
+			return
+		}
+		w.logf("Warning: the following url: %v serves more than the %v bytes reported by the index, storing it on disk", redactURL(fi.URL), fi.Size)
+	}
+
+	tempFile, err := w.tempFileFor(fi, partial)
 	if err != nil {
-		return virtualFile{}, errors.Wrap(err, "Error: unable to create temporary file in "+w.tmpDir)
+		return virtualFile{}, err
 	}
 	fclose := func() error {
 		err1 := errors.Wrapf(tempFile.Close(), "Error while closing reader of file %v", tempFile.Name())
@@ -114,46 +846,441 @@ func (w Wikidump) store(ctx context.Context, fi fileInfo) (r virtualFile, err er
 		return r, err
 	}
 
-	body, err := stream(ctx, fi)
-	if err != nil {
+	if err = w.fetchInto(ctx, fi, tempFile); err != nil {
+		if w.resumable(fi, tempFile, err) && tempFile.Close() == nil {
+			*partial = tempFile.Name()
+			return virtualFile{}, err
+		}
 		return fail(err)
 	}
-	defer body.Close()
 
-	hash := sha1.New()
-	_, err = io.Copy(io.MultiWriter(tempFile, hash), body)
-	if err != nil {
-		return fail(errors.Wrap(err, "Error: unable to copy to file the following url: "+fi.URL))
+	if err = tempFile.Close(); err != nil {
+		return fail(errors.Wrap(err, "Error: unable to close the following file: "+tempFile.Name()))
 	}
 
-	if fmt.Sprintf("%x", hash.Sum(nil)) != fi.SHA1 {
-		return fail(errors.New("Error: mismatched SHA1 for the file downloaded from the following url: " + fi.URL))
+	if w.verifyOnDisk {
+		if err = w.verifyStored(tempFile.Name(), fi); err != nil {
+			return fail(errors.Wrap(err, "Error: stored file failed verification"))
+		}
 	}
 
-	if err = tempFile.Close(); err != nil {
-		return fail(errors.Wrap(err, "Error: unable to close the following file: "+tempFile.Name()))
+	if cachePath := w.cachePath(fi); cachePath != "" {
+		if err = moveFile(tempFile.Name(), cachePath); err != nil {
+			return fail(errors.Wrap(err, "Error: unable to move to the cache the following file: "+tempFile.Name()))
+		}
+		if r, ok := w.cached(fi); ok {
+			return r, nil
+		}
+		return virtualFile{}, errors.New("Error: unable to open the following cached file: " + cachePath)
 	}
 
 	if tempFile, err = os.Open(tempFile.Name()); err != nil {
 		return fail(errors.Wrap(err, "Error: unable to open the following file: "+tempFile.Name()))
 	}
 
-	return virtualFile{tempFile, fclose, tempFile.Name()}, nil
+	name := tempFile.Name()
+	w.materialized.add(fi.URL, name)
+	return virtualFile{tempFile, func() error {
+		w.materialized.remove(fi.URL, name)
+		return fclose()
+	}, name}, nil
+}
+
+//storeInMemory buffers in memory the resource associated with fi, 7z archives are excluded as they need a file.
+//The memory is reserved from the memory budget, if any, until the returned file is closed.
+func (w Wikidump) storeInMemory(ctx context.Context, fi fileInfo) (virtualFile, error) {
+	if err := w.memory.acquire(ctx, fi.Size); err != nil {
+		return virtualFile{}, errors.Wrap(err, "Error: unable to reserve memory for the following url: "+fi.URL)
+	}
+	var once sync.Once
+	release := func() error {
+		once.Do(func() { w.memory.release(fi.Size) })
+		return nil
+	}
+
+	buffer := bytes.NewBuffer(make([]byte, 0, fi.Size))
+	if err := w.fetch(ctx, fi, &boundedWriter{buffer, fi.Size}); err != nil {
+		release()
+		return virtualFile{}, err
+	}
+	return virtualFile{bytes.NewReader(buffer.Bytes()), release, path.Base(fi.URL)}, nil
+}
+
+//errOversized is returned when a resource buffered in memory exceeds the size reported by the index.
+var errOversized = errors.New("resource larger than its reported size")
+
+//boundedWriter writes into w at most n bytes, failing with errOversized after them.
+type boundedWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (b *boundedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > b.n {
+		return 0, errOversized
+	}
+	b.n -= int64(len(p))
+	return b.w.Write(p)
+}
+
+//fetch downloads the resource associated with fi into dst, verifying its SHA1.
+func (w Wikidump) fetch(ctx context.Context, fi fileInfo, dst io.Writer) (err error) {
+	return w.fetchResumed(ctx, fi, dst, resumption{})
 }
 
-func stream(ctx context.Context, fi fileInfo) (r io.ReadCloser, err error) {
-	req, err := http.NewRequest("GET", fi.URL, nil)
+//fetchResumed downloads into dst the resource associated with fi, resuming it after the bytes already stored, if any.
+func (w Wikidump) fetchResumed(ctx context.Context, fi fileInfo, dst io.Writer, res resumption) (err error) {
+	var received int64
+	if w.grace > 0 && fi.Size > 0 {
+		if err = ctx.Err(); err != nil {
+			return errors.Wrap(err, "Error: download skipped for the following url: "+fi.URL)
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = w.withGrace(ctx, fi, &received)
+		defer cancel()
+		dst = io.MultiWriter(dst, countingWriter{&received})
+	}
+
+	var idle *idleTimeout
+	if w.idleTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		idle = newIdleTimeout(w.idleTimeout, cancel)
+		defer idle.Stop()
+	}
+
+	body, resp, err := w.streamWith(ctx, fi, res.header())
+	if err != nil {
+		return idle.Check(err, fi.URL)
+	}
+	defer body.Close()
+	if res.validated != nil {
+		*res.validated = validators{resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")}
+	}
+
+	name, hash, sum := fi.checksum()
+	h := hash.New()
+	var stored int64 //bytes stored by previous attempts
+	if res.offset > 0 {
+		if !res.resumedBy(resp) {
+			w.logf("Warning: ranges not supported for the following url: %v, restarting the download", redactURL(fi.URL))
+			if err = res.restart(); err != nil {
+				return errors.Wrap(err, "Error: unable to restart the download of the following url: "+fi.URL)
+			}
+		} else if _, err = io.Copy(h, res.prefix); err != nil {
+			return errors.Wrap(err, "Error: unable to read the partial download of the following url: "+fi.URL)
+		} else {
+			stored = res.offset
+			atomic.AddInt64(&received, stored)
+		}
+	}
+	if w.events != nil {
+		dst = io.MultiWriter(dst, newProgressWriter(ctx, w, fi, stored))
+	}
+	var progress *progressReporter
+	if w.progressFunc != nil {
+		total := int64(-1)
+		if resp.ContentLength >= 0 {
+			total = stored + resp.ContentLength
+		}
+		progress = newProgressReporter(w.progressFunc, path.Base(fi.URL), stored, total)
+		dst = io.MultiWriter(dst, progress)
+	}
+	n, err := io.Copy(io.MultiWriter(dst, h), idle.Reader(body))
+	w.stats.update(func(s *Stats) { s.BytesReceived += n })
+	if err != nil {
+		return idle.Check(errors.Wrap(err, "Error: unable to copy to file the following url: "+fi.URL), fi.URL)
+	}
+	progress.Flush()
+	w.logf("Downloaded %v bytes from the following url: %v", stored+n, redactURL(fi.URL))
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return errors.Wrapf(ErrTruncated, "Error: %v bytes received instead of %v from the following url: %v", n, resp.ContentLength, fi.URL)
+	}
+
+	if !w.verifies(fi) {
+		return
+	}
+	if fmt.Sprintf("%x", h.Sum(nil)) != sum {
+		w.logf("Warning: mismatched %v for the following url: %v", name, redactURL(fi.URL))
+		return errors.Wrap(ErrChecksumMismatch, "Error: mismatched "+name+" for the file downloaded from the following url: "+fi.URL)
+	}
+	w.emit(ctx, Event{Kind: Verified, URL: fi.URL})
+
+	return
+}
+
+func (w Wikidump) stream(ctx context.Context, fi fileInfo) (r io.ReadCloser, err error) {
+	r, _, err = w.streamWith(ctx, fi, nil)
+	return
+}
+
+//streamWith requests the resource associated with fi adding header to the request, it returns the body to read
+//along with the response. Resources with a file:// url, or mirrored on one, are read from the local filesystem.
+func (w Wikidump) streamWith(ctx context.Context, fi fileInfo, header http.Header) (r io.ReadCloser, resp *http.Response, err error) {
+	if w.fetcher != nil {
+		return w.fetchWith(ctx, fi)
+	}
+
+	target := w.mirrorURL(fi.URL)
+	if strings.HasPrefix(target, "file://") {
+		return openLocal(target, header)
+	}
+
+	req, err := http.NewRequest("GET", target, nil)
 	if err != nil {
 		err = errors.Wrap(err, "Error: unable create a request with the following url: "+fi.URL)
 		return
 	}
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	if w.headersFor != nil {
+		for key, values := range w.headersFor(fi.URL) {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
+	}
+
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", w.agent())
+	}
+
+	resp, err = w.client().Do(req.WithContext(ctx))
+	if err != nil {
+		if w.trafficLog {
+			cause, urlErr := err, (*url.Error)(nil)
+			if errors.As(err, &urlErr) { //it repeats the url, query included
+				cause = urlErr.Err
+			}
+			w.logf("%v %v: %v", req.Method, redact(req.URL), cause)
+		}
+		err = requestError(err, fi.URL)
+		return
+	}
+
+	if w.trafficLog {
+		w.logf("%v %v: %v", req.Method, redact(req.URL), resp.Status)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxStatusSnippet))
+		resp.Body.Close()
+		statusErr := &StatusError{resp.StatusCode, resp.Status, fi.URL, string(snippet), 0}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			statusErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+		err = statusErr
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			err = permanent(err)
+		}
+		return nil, resp, err
+	}
+
+	r = w.rateLimiter.throttled(ctx, resp.Body)
+	if w.trafficLog {
+		r = &trafficLogger{r, 0, func(n int64) { w.logf("%v %v: %v bytes received", req.Method, redact(req.URL), n) }}
+	}
+	return
+}
+
+//fetchWith requests the resource associated with fi with the function set by WithFetch,
+//the response reports the headers returned by it.
+func (w Wikidump) fetchWith(ctx context.Context, fi fileInfo) (io.ReadCloser, *http.Response, error) {
+	r, header, err := w.fetcher(ctx, fi.URL)
+	if err != nil {
+		return nil, nil, requestError(err, fi.URL)
+	}
+	return r, &http.Response{Status: "200 OK", StatusCode: http.StatusOK, Header: header, Body: r, ContentLength: -1}, nil
+}
+
+//StatusError is returned when a request gets a response with a non-2xx status code, along with the beginning of its body.
+//Server errors (5xx) and 429 Too Many Requests are retried, the other ones are not.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	URL        string
+	Body       string
+	RetryAfter time.Duration //the wait requested by the Retry-After header of 429 and 503 responses, if any
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Error: %v for the following url: %v: %q", e.Status, e.URL, e.Body)
+}
+
+//parseRetryAfter returns the wait requested by value, a Retry-After header in seconds or as an HTTP date, or 0 if invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+//retryAfter returns the wait requested by the server along with err, if any.
+func retryAfter(err error) time.Duration {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.RetryAfter
+	}
+	return 0
+}
 
-	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+//maxStatusSnippet is the maximum length of the body reported by a StatusError.
+const maxStatusSnippet = 512
+
+//peek returns up to the first n bytes of the resource associated with fi, requesting only them.
+func (w Wikidump) peek(ctx context.Context, fi fileInfo, n int64) ([]byte, error) {
+	r, _, err := w.streamWith(ctx, fi, http.Header{"Range": {fmt.Sprintf("bytes=0-%v", n-1)}})
 	if err != nil {
-		err = errors.Wrap(err, "Error: unable do a request with the following url: "+fi.URL)
+		return nil, err
+	}
+	defer r.Close()
+
+	header, err := ioutil.ReadAll(io.LimitReader(r, n))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error: unable to read the following url: "+fi.URL)
+	}
+	return header, nil
+}
+
+//agent returns the User-Agent of the requests, as set by WithUserAgent or else UserAgent.
+func (w Wikidump) agent() string {
+	if w.userAgent != "" {
+		return w.userAgent
+	}
+	return UserAgent
+}
+
+//baseClient returns the client set by WithHTTPClient or else http.DefaultClient.
+func (w Wikidump) baseClient() *http.Client {
+	if w.httpClient != nil {
+		return w.httpClient
+	}
+	return http.DefaultClient
+}
+
+//stackRoundTrippers stacks the middlewares set by WithRoundTrippers over the transport of the base client,
+//so that they're built once and their state is shared by all the requests.
+func (w *Wikidump) stackRoundTrippers() {
+	w.transport = nil
+	if len(w.roundTrippers) == 0 {
 		return
 	}
+	transport := w.baseClient().Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	for _, middleware := range w.roundTrippers {
+		transport = middleware(transport)
+	}
+	w.transport = transport
+}
+
+//client returns the HTTP client for the downloads, the one set by WithHTTPClient or else http.DefaultClient,
+//with the middlewares set by WithRoundTrippers, if any, stacked over its transport.
+func (w Wikidump) client() *http.Client {
+	base := w.baseClient()
+	if w.transport == nil && w.redirectHosts == nil {
+		return base
+	}
+	client := *base
+	if w.transport != nil {
+		client.Transport = w.transport
+	}
+	if w.redirectHosts != nil {
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if !w.redirectHosts[req.URL.Hostname()] {
+				return errors.Wrap(ErrDisallowedRedirect, "Error: redirected to the following host: "+req.URL.Hostname())
+			}
+			if base.CheckRedirect != nil {
+				return base.CheckRedirect(req, via)
+			}
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return nil
+		}
+	}
+	return &client
+}
+
+//redactURL redacts rawURL as redact does, if it's a valid url.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return redact(u)
+}
+
+//redact strips credentials and query parameters, that may contain tokens, from u.
+func redact(u *url.URL) string {
+	redacted := *u
+	redacted.User, redacted.RawQuery, redacted.Fragment = nil, "", ""
+	return redacted.String()
+}
+
+//trafficLogger counts the bytes read from a response body, reporting them on Close.
+type trafficLogger struct {
+	io.ReadCloser
+	n      int64
+	report func(n int64)
+}
 
-	r = resp.Body
+func (t *trafficLogger) Read(p []byte) (n int, err error) {
+	n, err = t.ReadCloser.Read(p)
+	t.n += int64(n)
 	return
 }
+
+func (t *trafficLogger) Close() error {
+	t.report(t.n)
+	return t.ReadCloser.Close()
+}
+
+//retriable reports whether a download should be retried after the attempt-th attempt failed with err.
+func (w Wikidump) retriable(err error, attempt int) bool {
+	if w.shouldRetry != nil {
+		return w.shouldRetry(err, attempt)
+	}
+	return !isPermanent(err)
+}
+
+//requestError annotates an error returned by an HTTP client, marking as permanent the ones that retrying can't fix.
+func requestError(err error, url string) error {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return permanent(errors.Wrapf(ErrHostNotFound, "Error: unable to resolve %v for the following url: %v", dnsErr.Name, url))
+	}
+	if errors.Is(err, ErrDisallowedRedirect) {
+		return permanent(errors.Wrap(err, "Error: unable do a request with the following url: "+url))
+	}
+	return errors.Wrap(err, "Error: unable do a request with the following url: "+url)
+}
+
+//permanentError marks an error that retrying can't fix.
+type permanentError struct {
+	error
+}
+
+func permanent(err error) error {
+	return permanentError{err}
+}
+
+func (e permanentError) Cause() error {
+	return e.error
+}
+
+func (e permanentError) Unwrap() error {
+	return e.error
+}
+
+func isPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
@@ -1,17 +1,35 @@
 package wikidump
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/sha1"
 	"encoding/base64"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
 	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
 )
 
 func TestUnit(t *testing.T) {
@@ -49,9 +67,9 @@ func TestUnit(t *testing.T) {
 func TestOpen(t *testing.T) {
 	ffi := make([]fileInfo, 0, len(name2MyInfo))
 	for name, info := range name2MyInfo {
-		ffi = append(ffi, fileInfo{"http://" + address + name, info.SHA1})
+		ffi = append(ffi, fileInfo{URL: "http://" + address + name, SHA1: info.SHA1})
 	}
-	tDump := Wikidump{map[string][]fileInfo{"helloword": ffi}, "", time.Now()}
+	tDump := Wikidump{file2Info: map[string][]fileInfo{"helloword": ffi}, date: time.Now()}
 	next := tDump.Open("helloword")
 	r, err := next(context.Background())
 	for ; err == nil; r, err = next(context.Background()) {
@@ -76,6 +94,176 @@ func TestOpen(t *testing.T) {
 	}
 }
 
+func TestOpenConcurrently(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(name2MyInfo["/helloword.gz"].Data)
+	}))
+	defer server.Close()
+
+	const parts = 8
+	ffi := make([]fileInfo, parts)
+	for i := range ffi {
+		ffi[i] = fileInfo{URL: fmt.Sprintf("%v/part%v.gz", server.URL, i), SHA1: name2MyInfo["/helloword.gz"].SHA1}
+	}
+	next := Wikidump{file2Info: map[string][]fileInfo{"parts": ffi}}.OpenNamed("parts")
+	var mu sync.Mutex
+	url2Count := map[string]int{}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				url, r, err := next(context.Background())
+				if err != nil {
+					if err != io.EOF {
+						t.Error("The iterator returns ", err)
+					}
+					return
+				}
+				r.Close()
+				mu.Lock()
+				url2Count[url]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(url2Count) != parts {
+		t.Error("Each part should be returned once, while they're returned as ", url2Count)
+	}
+	for url, count := range url2Count {
+		if count != 1 {
+			t.Error(url, "is returned", count, "times")
+		}
+	}
+}
+
+func TestCancelledOpen(t *testing.T) {
+	started := make(chan struct{}, 8)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/fast") {
+			w.Write(name2MyInfo["/helloword.gz"].Data)
+			return
+		}
+		w.Write(make([]byte, 1<<16))
+		w.(http.Flusher).Flush()
+		started <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	for _, options := range [][]Option{nil, {WithPrefetch(2)}, {WithShuffledParts(true)}} {
+		dir, err := ioutil.TempDir("", "wikidump")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		ffi := []fileInfo{
+			{URL: server.URL + "/fast.gz", SHA1: name2MyInfo["/helloword.gz"].SHA1},
+			{URL: server.URL + "/large.gz", SHA1: "large"},
+			{URL: server.URL + "/fast2.gz", SHA1: name2MyInfo["/helloword.gz"].SHA1},
+		}
+		tDump, err := Wikidump{file2Info: map[string][]fileInfo{"parts": ffi}, tmpDir: dir}.With(options...)
+		if err != nil {
+			t.Fatal("With returns ", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-started
+			cancel()
+		}()
+		next := tDump.Open("parts")
+		for {
+			r, err := next(ctx)
+			if err != nil {
+				break
+			}
+			r.Close()
+		}
+		cancel()
+
+		if infos, err := ioutil.ReadDir(dir); err != nil || len(infos) != 0 {
+			t.Error("No temporary file should survive the cancellation, while there are ", len(infos), err)
+		}
+	}
+}
+
+func TestOpenNamed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(name2MyInfo[r.URL.Path].Data)
+	}))
+	defer server.Close()
+
+	ffi := []fileInfo{
+		{URL: server.URL + "/helloword.gz", SHA1: name2MyInfo["/helloword.gz"].SHA1},
+		{URL: server.URL + "/helloword.bz2", SHA1: "wrong"},
+	}
+	tDump, err := Wikidump{file2Info: map[string][]fileInfo{"helloword": ffi}}.With(WithShouldRetry(func(error, int) bool { return false }))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	next := tDump.OpenNamed("helloword")
+	url, r, err := next(context.Background())
+	if err != nil || url != ffi[0].URL {
+		t.Fatal("The iterator returns ", url, err)
+	}
+	r.Close()
+	for i := 0; i < 2; i++ {
+		if url, _, err := next(context.Background()); err == nil || url != ffi[1].URL {
+			t.Error("The iterator should report the url of the failed part, while it returns ", url, err)
+		}
+	}
+
+	next = Wikidump{file2Info: map[string][]fileInfo{"helloword": ffi[:1]}}.OpenNamed("helloword")
+	if _, r, err := next(context.Background()); err == nil {
+		r.Close()
+	}
+	if url, _, err := next(context.Background()); err != io.EOF || url != "" {
+		t.Error("The depleted iterator returns ", url, err)
+	}
+}
+
+func TestOpenAll(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(name2MyInfo[r.URL.Path].Data)
+	}))
+	defer server.Close()
+
+	gz := fileInfo{URL: server.URL + "/helloword.gz", SHA1: name2MyInfo["/helloword.gz"].SHA1}
+	bz2 := fileInfo{URL: server.URL + "/helloword.bz2", SHA1: name2MyInfo["/helloword.bz2"].SHA1}
+	tDump, err := Wikidump{file2Info: map[string][]fileInfo{
+		"helloword": {gz, bz2},
+		"corrupted": {gz, {URL: bz2.URL, SHA1: "wrong"}},
+	}}.With(WithShouldRetry(func(error, int) bool { return false }))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+
+	r, err := tDump.OpenAll(context.Background(), "helloword")
+	if err != nil {
+		t.Fatal("OpenAll returns ", err)
+	}
+	if data, err := ioutil.ReadAll(r); err != nil || string(data) != helloword+helloword {
+		t.Errorf("Reading returns %q %v", data, err)
+	}
+	r.Close()
+
+	r, err = tDump.OpenAll(context.Background(), "corrupted")
+	if err != nil {
+		t.Fatal("OpenAll returns ", err)
+	}
+	if data, err := ioutil.ReadAll(r); !errors.Is(err, ErrChecksumMismatch) || string(data) != helloword {
+		t.Errorf("Reading should return the first part and then ErrChecksumMismatch, while it returns %q %v", data, err)
+	}
+	r.Close()
+
+	if _, err := tDump.OpenAll(context.Background(), "nothing"); !errors.Is(err, ErrFileNotFound) {
+		t.Error("OpenAll should return ErrFileNotFound, while it returns ", err)
+	}
+}
+
 const helloword = "Hello, World!"
 const address = ":8080"
 
@@ -113,3 +301,1000 @@ func TestMain(m *testing.M) {
 
 	os.Exit(m.Run())
 }
+
+func TestOpenShuffled(t *testing.T) {
+	const parts = 8
+	var mu sync.Mutex
+	var requested []string
+	name2Info := map[string]myInfo{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		w.Write(name2Info[r.URL.Path].Data)
+	}))
+	defer server.Close()
+
+	ffi := make([]fileInfo, parts)
+	for i := range ffi {
+		name := fmt.Sprintf("/part%v.gz", i)
+		name2Info[name] = gzipMyInfo(fmt.Sprint("part", i))
+		ffi[i] = fileInfo{URL: server.URL + name, SHA1: name2Info[name].SHA1}
+	}
+	tDump, err := Wikidump{file2Info: map[string][]fileInfo{"parts": ffi}}.With(WithShuffledParts(true))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+
+	next := tDump.Open("parts")
+	for i := 0; i < parts; i++ {
+		r, err := next(context.Background())
+		if err != nil {
+			t.Fatal("Open iterator returns ", err)
+		}
+		mu.Lock()
+		if len(requested) != parts {
+			t.Error("All parts should be downloaded before the first one is returned")
+		}
+		mu.Unlock()
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Error("Open iterator returns ", err)
+		}
+		if expected := fmt.Sprint("part", i); string(data) != expected {
+			t.Error("Data should be " + expected + " but it's " + string(data))
+		}
+		if err := r.Close(); err != nil {
+			t.Error("Closing returns ", err)
+		}
+	}
+	if _, err := next(context.Background()); err != io.EOF {
+		t.Error("Open iterator should be depleted, while it returns ", err)
+	}
+}
+
+func gzipMyInfo(s string) myInfo {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write([]byte(s)); err != nil {
+		panic(err)
+	}
+	if err := w.Close(); err != nil {
+		panic(err)
+	}
+	return myInfo{b.Bytes(), fmt.Sprintf("%x", sha1.Sum(b.Bytes()))}
+}
+
+func TestSniffing(t *testing.T) {
+	//bzip2 content served under a gzip name
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(name2MyInfo["/helloword.bz2"].Data)
+	}))
+	defer server.Close()
+	fi := fileInfo{URL: server.URL + "/helloword.gz", SHA1: name2MyInfo["/helloword.bz2"].SHA1}
+
+	var logs bytes.Buffer
+	tDump, err := Wikidump{}.With(WithSniffing(true), WithLogger(log.New(&logs, "", 0)))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	r, err := tDump.open(context.Background(), fi)
+	if err != nil {
+		t.Fatal("open returns ", err)
+	}
+	data, err := ioutil.ReadAll(r)
+	switch {
+	case err != nil:
+		t.Error("Reading returns ", err)
+	case string(data) != helloword:
+		t.Error("Data should be " + helloword + " but it's " + string(data))
+	case !strings.Contains(logs.String(), "bzip2"):
+		t.Error("A warning should be logged, while the log is ", logs.String())
+	}
+	if err := r.Close(); err != nil {
+		t.Error("Closing returns ", err)
+	}
+
+	tDump, err = tDump.With(WithStrictSniffing(true))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	if _, err := tDump.open(context.Background(), fi); !errors.Is(err, ErrFormatMismatch) {
+		t.Error("open should return ErrFormatMismatch, while it returns ", err)
+	}
+}
+
+func TestDecompressorFor(t *testing.T) {
+	//bzip2 content served under any name
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(name2MyInfo["/helloword.bz2"].Data)
+	}))
+	defer server.Close()
+	tDump := Wikidump{file2Info: map[string][]fileInfo{
+		"gzip":  {{URL: server.URL + "/helloword.gz"}},
+		"bzip2": {{URL: server.URL + "/helloword.bz2"}},
+		"7z":    {{URL: server.URL + "/helloword.7z"}},
+		"none":  {{URL: server.URL + "/helloword.txt"}},
+	}}
+
+	for filename := range tDump.file2Info {
+		if decompressor, err := tDump.DecompressorFor(filename); err != nil || decompressor != filename {
+			t.Error("DecompressorFor", filename, "should be", filename, "but it's", decompressor, err)
+		}
+	}
+	if _, err := tDump.DecompressorFor("missing"); !errors.Is(err, ErrFileNotFound) {
+		t.Error("DecompressorFor should return ErrFileNotFound, while it returns ", err)
+	}
+
+	sniffing, err := tDump.With(WithSniffing(true))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	if decompressor, err := sniffing.DecompressorFor("gzip"); err != nil || decompressor != "bzip2" {
+		t.Error("DecompressorFor should sniff bzip2, while it returns ", decompressor, err)
+	}
+	strict, err := tDump.With(WithStrictSniffing(true))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	if _, err := strict.DecompressorFor("gzip"); !errors.Is(err, ErrFormatMismatch) {
+		t.Error("DecompressorFor should return ErrFormatMismatch, while it returns ", err)
+	}
+	disabled, err := strict.With(WithSniffing(false))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	if decompressor, err := disabled.DecompressorFor("gzip"); err != nil || decompressor != "gzip" {
+		t.Error("DecompressorFor should follow the extension once sniffing is disabled, while it returns ", decompressor, err)
+	}
+}
+
+// upperCaser upper-cases the content read from r.
+type upperCaser struct {
+	r io.Reader
+}
+
+func (u upperCaser) Read(p []byte) (n int, err error) {
+	n, err = u.r.Read(p)
+	copy(p, bytes.ToUpper(p[:n]))
+	return
+}
+
+func TestFilter(t *testing.T) {
+	server, _ := countingServer()
+	defer server.Close()
+
+	tDump, err := Wikidump{}.With(WithFilter(func(r io.Reader) io.Reader { return upperCaser{r} }))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	for name, info := range name2MyInfo {
+		r, err := tDump.open(context.Background(), fileInfo{URL: server.URL + name, SHA1: info.SHA1})
+		if err != nil {
+			t.Fatal("open returns ", err)
+		}
+		if data, err := ioutil.ReadAll(r); err != nil || string(data) != strings.ToUpper(helloword) {
+			t.Error("Reading", name, "returns", string(data), err)
+		}
+		if err := r.Close(); err != nil {
+			t.Error("Closing returns ", err)
+		}
+	}
+
+	//filter errors propagate
+	filterErr := errors.New("filter failure")
+	tDump, err = tDump.With(WithFilter(func(r io.Reader) io.Reader { return iotest.ErrReader(filterErr) }))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	r, err := tDump.open(context.Background(), fileInfo{URL: server.URL + "/helloword.gz", SHA1: name2MyInfo["/helloword.gz"].SHA1})
+	if err != nil {
+		t.Fatal("open returns ", err)
+	}
+	if _, err := ioutil.ReadAll(r); !errors.Is(err, filterErr) {
+		t.Error("Reading should return the filter error, while it returns ", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Error("Closing returns ", err)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	var urls []string
+	fetch := func(ctx context.Context, url string) (io.ReadCloser, http.Header, error) {
+		urls = append(urls, url)
+		info, ok := name2MyInfo[strings.TrimPrefix(url, "fixture://")]
+		if !ok {
+			return nil, nil, errors.New("fixture not found")
+		}
+		return ioutil.NopCloser(bytes.NewReader(info.Data)), http.Header{}, nil
+	}
+	tDump, err := Wikidump{}.With(WithFetch(fetch), WithSegments(4), WithShouldRetry(func(error, int) bool { return false }))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	for name, info := range name2MyInfo {
+		r, err := tDump.open(context.Background(), fileInfo{URL: "fixture://" + name, SHA1: info.SHA1, Size: int64(len(info.Data))})
+		if err != nil {
+			t.Fatal("open returns ", err)
+		}
+		if data, err := ioutil.ReadAll(r); err != nil || string(data) != helloword {
+			t.Error("Reading", name, "returns", string(data), err)
+		}
+		r.Close()
+	}
+	if len(urls) != len(name2MyInfo) {
+		t.Error("fetch should be called once for each file, while it's called", len(urls), "times")
+	}
+
+	//the content is still verified
+	if _, err := tDump.open(context.Background(), fileInfo{URL: "fixture:///helloword.gz", SHA1: name2MyInfo["/helloword.bz2"].SHA1}); err == nil {
+		t.Error("Opening a file with a mismatched SHA1 should fail")
+	}
+	if _, err := tDump.open(context.Background(), fileInfo{URL: "fixture:///missing.gz"}); err == nil || !strings.Contains(err.Error(), "fixture not found") {
+		t.Error("fetch errors should propagate, while open returns ", err)
+	}
+}
+
+func TestCompressionFormats(t *testing.T) {
+	format2Case := map[string]struct {
+		newWriter func(io.Writer) (io.WriteCloser, error)
+		names     []string //names without an extension are detected by sniffing
+	}{
+		"lz4":  {func(w io.Writer) (io.WriteCloser, error) { return lz4.NewWriter(w), nil }, []string{"helloword.lz4", "helloword"}},
+		"zstd": {func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) }, []string{"helloword.zst", "helloword"}},
+		"xz":   {func(w io.Writer) (io.WriteCloser, error) { return xz.NewWriter(w) }, []string{"helloword.xz", "helloword"}},
+		"lzma": {func(w io.Writer) (io.WriteCloser, error) { return lzma.NewWriter(w) }, []string{"helloword.lzma"}},
+	}
+	format2Data := map[string][]byte{}
+	for format, c := range format2Case {
+		var b bytes.Buffer
+		w, err := c.newWriter(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(helloword)); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		format2Data[format] = b.Bytes()
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(format2Data[path.Dir(r.URL.Path)[1:]])
+	}))
+	defer server.Close()
+
+	tDump, err := Wikidump{}.With(WithSniffing(true))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	for format, c := range format2Case {
+		for _, name := range c.names {
+			fi := fileInfo{URL: server.URL + "/" + format + "/" + name, SHA1: fmt.Sprintf("%x", sha1.Sum(format2Data[format]))}
+			r, err := tDump.open(context.Background(), fi)
+			if err != nil {
+				t.Fatal("open returns ", err)
+			}
+			if data, err := ioutil.ReadAll(r); err != nil || string(data) != helloword {
+				t.Error("Reading", format, name, "returns", string(data), err)
+			}
+			if err := r.Close(); err != nil {
+				t.Error("Closing returns ", err)
+			}
+		}
+	}
+}
+
+func TestCorruptZstd(t *testing.T) {
+	corrupt := append([]byte{0x28, 0xB5, 0x2F, 0xFD}, []byte("garbage")...)
+	r, err := unZstd(virtualFile{bytes.NewReader(corrupt), func() error { return nil }, "corrupt.zst"})
+	if err == nil {
+		_, err = ioutil.ReadAll(r)
+		r.Close()
+	}
+	if err == nil {
+		t.Error("Decompressing a corrupt file should fail")
+	}
+}
+
+func TestGzipMultistream(t *testing.T) {
+	data := append(gzipMyInfo(helloword[:5]).Data, gzipMyInfo(helloword[5:]).Data...)
+	r, err := unGZip(virtualFile{bytes.NewReader(data), func() error { return nil }, "helloword.gz"})
+	if err != nil {
+		t.Fatal("unGZip returns ", err)
+	}
+	if data, err := ioutil.ReadAll(r); err != nil || string(data) != helloword {
+		t.Error("Reading a two-member gzip file returns ", string(data), err)
+	}
+	if err := r.Close(); err != nil {
+		t.Error("Closing returns ", err)
+	}
+}
+
+func TestSpillThreshold(t *testing.T) {
+	incompressible := make([]byte, 1<<16)
+	rand.New(rand.NewSource(0)).Read(incompressible)
+	large := gzipMyInfo(string(incompressible))
+	name2Info := map[string]myInfo{"/small.gz": name2MyInfo["/helloword.gz"], "/large.gz": large}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(name2Info[r.URL.Path].Data)
+	}))
+	defer server.Close()
+
+	tmpDir, err := ioutil.TempDir("", "wikidump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	tDump, err := Wikidump{tmpDir: tmpDir}.With(WithSpillThreshold(1 << 10))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+
+	for name, expected := range map[string]int{"/small.gz": 0, "/large.gz": 1} {
+		info := name2Info[name]
+		r, err := tDump.open(context.Background(), fileInfo{URL: server.URL + name, SHA1: info.SHA1, Size: int64(len(info.Data))})
+		if err != nil {
+			t.Fatal("open returns ", err)
+		}
+		if files, _ := ioutil.ReadDir(tmpDir); len(files) != expected {
+			t.Error(name, "should use", expected, "temporary files, while it uses", len(files))
+		}
+		if _, err := ioutil.ReadAll(r); err != nil {
+			t.Error("Reading returns ", err)
+		}
+		if err := r.Close(); err != nil {
+			t.Error("Closing returns ", err)
+		}
+	}
+
+	//resources larger than reported are spilled to disk, releasing the memory reserved
+	tDump, err = tDump.With(WithMemoryBudget(1 << 10))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	info := name2Info["/small.gz"]
+	r, err := tDump.open(context.Background(), fileInfo{URL: server.URL + "/small.gz", SHA1: info.SHA1, Size: int64(len(info.Data)) - 1})
+	if err != nil {
+		t.Fatal("open returns ", err)
+	}
+	if files, _ := ioutil.ReadDir(tmpDir); len(files) != 1 {
+		t.Error("A resource larger than reported should use a temporary file, while it uses", len(files))
+	}
+	if data, err := ioutil.ReadAll(r); err != nil || string(data) != helloword {
+		t.Error("Reading returns ", string(data), err)
+	}
+	r.Close()
+	if used := tDump.memory.used; used != 0 {
+		t.Error("The memory reserved should be released, while", used, "bytes are in use")
+	}
+}
+
+func TestBeforeAttempt(t *testing.T) {
+	var mu sync.Mutex
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		downloads++
+		mu.Unlock()
+		w.Write([]byte("corrupted"))
+	}))
+	defer server.Close()
+
+	errTooMany := errors.New("too many attempts")
+	tDump, err := Wikidump{}.With(WithBeforeAttempt(func(ctx context.Context, url string, attempt int) error {
+		if attempt > 2 {
+			return errTooMany
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+
+	fi := fileInfo{URL: server.URL + "/helloword.gz", SHA1: name2MyInfo["/helloword.gz"].SHA1}
+	if _, err := tDump.stubbornStore(context.Background(), fi); !errors.Is(err, errTooMany) {
+		t.Error("stubbornStore should return the error of the hook, while it returns ", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if downloads != 2 {
+		t.Error("The hook should abort after 2 attempts, while they're", downloads)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	for _, args := range [][3]int{{0, 1, 2}, {3, -1, 2}, {3, 2, 1}} {
+		if _, err := (Wikidump{}).With(WithRetryPolicy(args[0], time.Duration(args[1]), time.Duration(args[2]))); err == nil {
+			t.Error("The retry policy", args, "should be invalid")
+		}
+	}
+
+	var mu sync.Mutex
+	var attempts []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts = append(attempts, time.Now())
+		mu.Unlock()
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	tDump, err := Wikidump{}.With(WithRetryPolicy(4, 50*time.Millisecond, 100*time.Millisecond))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	if _, err := tDump.stubbornStore(context.Background(), fileInfo{URL: server.URL + "/helloword.gz"}); err == nil {
+		t.Error("Error should be not null")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(attempts) != 4 {
+		t.Fatal("The download should be attempted 4 times, while it's attempted", len(attempts), "times")
+	}
+	for i, max := range []time.Duration{50, 100, 100} {
+		if delay := attempts[i+1].Sub(attempts[i]); delay > max*time.Millisecond+500*time.Millisecond {
+			t.Error("The delay before attempt", i+2, "should be up to", max*time.Millisecond, "while it's", delay)
+		}
+	}
+}
+
+func TestJitter(t *testing.T) {
+	j, same := newJitter(1), newJitter(1)
+	var nilJitter *jitter
+	distinct := map[time.Duration]bool{}
+	for i := 0; i < 100; i++ {
+		delay := j.delay(time.Second)
+		if delay < 0 || delay >= time.Second || nilJitter.delay(time.Second) >= time.Second {
+			t.Fatal("The delay should be in [0, 1s), while it's ", delay)
+		}
+		if other := same.delay(time.Second); other != delay {
+			t.Fatal("Jitters with the same seed should draw the same delays, while they draw ", delay, other)
+		}
+		distinct[delay] = true
+	}
+	if len(distinct) < 90 {
+		t.Error("The delays should be random, while there are only", len(distinct), "distinct ones")
+	}
+	if j.delay(0) != 0 {
+		t.Error("A null bound should give a null delay")
+	}
+}
+
+func TestUncompressedSHA1(t *testing.T) {
+	file2Info := map[string][]fileInfo{}
+	for _, name := range []string{"/helloword.gz", "/helloword.bz2"} {
+		file2Info[name] = []fileInfo{{URL: "http://" + address + name, SHA1: name2MyInfo[name].SHA1}}
+	}
+	tDump := Wikidump{file2Info: file2Info}
+
+	expected := fmt.Sprintf("%x", sha1.Sum([]byte(helloword)))
+	for name := range file2Info {
+		sum, err := tDump.UncompressedSHA1(context.Background(), name)
+		switch {
+		case err != nil:
+			t.Error("UncompressedSHA1 returns ", err)
+		case sum != expected:
+			t.Error("UncompressedSHA1 of", name, "should be", expected, "but it's", sum)
+		}
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(name2MyInfo["/helloword.gz"].Data[:8])
+		w.(http.Flusher).Flush()
+		<-r.Context().Done() //stall
+	}))
+	defer server.Close()
+
+	tDump, err := Wikidump{}.With(WithIdleTimeout(100 * time.Millisecond))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	fi := fileInfo{URL: server.URL + "/helloword.gz", SHA1: name2MyInfo["/helloword.gz"].SHA1}
+	if err := tDump.fetch(context.Background(), fi, ioutil.Discard); !errors.Is(err, ErrIdleTimeout) {
+		t.Error("fetch should return ErrIdleTimeout, while it returns ", err)
+	}
+}
+
+func TestHeadersFor(t *testing.T) {
+	var mu sync.Mutex
+	path2Header := map[string]http.Header{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		path2Header[r.URL.Path] = r.Header
+		mu.Unlock()
+		w.Write(name2MyInfo[r.URL.Path].Data)
+	}))
+	defer server.Close()
+
+	tDump, err := Wikidump{}.With(WithHeadersFor(func(url string) http.Header {
+		return http.Header{"X-Token": {"token-for-" + path.Base(url)}}
+	}))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	for name, info := range name2MyInfo {
+		if err := tDump.fetch(context.Background(), fileInfo{URL: server.URL + name, SHA1: info.SHA1}, ioutil.Discard); err != nil {
+			t.Error("fetch returns ", err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for name := range name2MyInfo {
+		header := path2Header[name]
+		if token := header.Get("X-Token"); token != "token-for-"+path.Base(name) {
+			t.Error("The token for", name, "should be token-for-"+path.Base(name), "but it's", token)
+		}
+		if header.Get("User-Agent") == "" {
+			t.Error("The User-Agent should be still present")
+		}
+	}
+}
+
+func TestHTTPClient(t *testing.T) {
+	server, _ := countingServer()
+	defer server.Close()
+
+	var mu sync.Mutex
+	var trace []string
+	client := &http.Client{Transport: recordingRoundTripper{http.DefaultTransport, &mu, &trace, "client"}}
+	outer := func(next http.RoundTripper) http.RoundTripper {
+		return recordingRoundTripper{next, &mu, &trace, "outer"}
+	}
+	fi := fileInfo{URL: server.URL + "/helloword.gz", SHA1: name2MyInfo["/helloword.gz"].SHA1}
+	//the middlewares wrap the transport of the client in either order
+	for _, options := range [][]Option{{WithHTTPClient(client), WithRoundTrippers(outer)}, {WithRoundTrippers(outer), WithHTTPClient(client)}} {
+		tDump, err := Wikidump{}.With(options...)
+		if err != nil {
+			t.Fatal("With returns ", err)
+		}
+		if err := tDump.fetch(context.Background(), fi, ioutil.Discard); err != nil {
+			t.Error("fetch returns ", err)
+		}
+	}
+
+	//the client of the Dumps is the default
+	dumps := Dumps{Client: &http.Client{Transport: recordingRoundTripper{http.DefaultTransport, &mu, &trace, "default"}}}
+	tDump, err := dumps.FromIndex("", "en", strings.NewReader(`{"jobs": {}}`), time.Time{})
+	if err != nil {
+		t.Fatal("FromIndex returns ", err)
+	}
+	if err := tDump.fetch(context.Background(), fi, ioutil.Discard); err != nil {
+		t.Error("fetch returns ", err)
+	}
+
+	//and the one of the Dumps too
+	if tDump, err = tDump.With(WithRoundTrippers(outer)); err != nil {
+		t.Fatal("With returns ", err)
+	}
+	if err := tDump.fetch(context.Background(), fi, ioutil.Discard); err != nil {
+		t.Error("fetch returns ", err)
+	}
+
+	expected := []string{"outer /helloword.gz", "client /helloword.gz", "outer /helloword.gz", "client /helloword.gz",
+		"default /helloword.gz", "outer /helloword.gz", "default /helloword.gz"}
+	if !reflect.DeepEqual(trace, expected) {
+		t.Error("The clients should be invoked as", expected, "while they're invoked as", trace)
+	}
+	if _, err := (Wikidump{}).With(WithHTTPClient(nil)); err == nil {
+		t.Error("A nil client should be rejected")
+	}
+}
+
+// recordingRoundTripper records the paths of the requests it forwards.
+type recordingRoundTripper struct {
+	next  http.RoundTripper
+	mu    *sync.Mutex
+	trace *[]string
+	name  string
+}
+
+func (rt recordingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	*rt.trace = append(*rt.trace, rt.name+" "+req.URL.Path)
+	rt.mu.Unlock()
+	return rt.next.RoundTrip(req)
+}
+
+func TestRoundTrippers(t *testing.T) {
+	server, requests := countingServer()
+	defer server.Close()
+
+	var mu sync.Mutex
+	var trace []string
+	constructions := 0
+	recording := func(name string) func(http.RoundTripper) http.RoundTripper {
+		return func(next http.RoundTripper) http.RoundTripper {
+			constructions++
+			return recordingRoundTripper{next, &mu, &trace, name}
+		}
+	}
+	tDump, err := Wikidump{}.With(WithRoundTrippers(recording("inner")), WithRoundTrippers(recording("outer")))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	constructed := constructions
+	for _, name := range []string{"/helloword.gz", "/helloword.bz2"} {
+		if err := tDump.fetch(context.Background(), fileInfo{URL: server.URL + name, SHA1: name2MyInfo[name].SHA1}, ioutil.Discard); err != nil {
+			t.Error("fetch returns ", err)
+		}
+		if requests(name) != 1 {
+			t.Error(name, "should be requested once, while it's requested", requests(name), "times")
+		}
+	}
+
+	expected := []string{"outer /helloword.gz", "inner /helloword.gz", "outer /helloword.bz2", "inner /helloword.bz2"}
+	if !reflect.DeepEqual(trace, expected) {
+		t.Error("The round trippers should be invoked as", expected, "while they're invoked as", trace)
+	}
+	if constructions != constructed {
+		t.Error("The round trippers should be constructed when the options are applied, while they're constructed", constructions-constructed, "more times by the requests")
+	}
+}
+
+func TestRedirectAllowlist(t *testing.T) {
+	server, requests := countingServer()
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	//the redirector sends every request to server
+	redirector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, server.URL+r.URL.Path, http.StatusFound)
+	}))
+	defer redirector.Close()
+
+	tDump, err := Wikidump{}.With(WithRedirectAllowlist(serverURL.Hostname()))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	fi := fileInfo{URL: redirector.URL + "/helloword.gz", SHA1: name2MyInfo["/helloword.gz"].SHA1}
+	if err := tDump.fetch(context.Background(), fi, ioutil.Discard); err != nil {
+		t.Error("Redirects to allowed hosts should be followed, while fetch returns ", err)
+	}
+
+	//the policy of the client still applies to allowed hosts
+	policy := errors.New("redirects are not allowed by the client")
+	tDump, err = tDump.With(WithHTTPClient(&http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return policy }}))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	if err := tDump.fetch(context.Background(), fi, ioutil.Discard); !errors.Is(err, policy) {
+		t.Error("fetch should return the error of the CheckRedirect of the client, while it returns ", err)
+	}
+
+	tDump, err = tDump.With(WithRedirectAllowlist(WikimediaHosts...))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	start := time.Now()
+	if _, err := tDump.stubbornStore(context.Background(), fi); !errors.Is(err, ErrDisallowedRedirect) {
+		t.Error("stubbornStore should return ErrDisallowedRedirect, while it returns ", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("Disallowed redirects should not be retried")
+	}
+	if requests("/helloword.gz") != 1 {
+		t.Error("The disallowed host should never be requested")
+	}
+}
+
+// truncatingRoundTripper serves helloword declaring a longer Content-Length.
+type truncatingRoundTripper struct{}
+
+func (truncatingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{Status: "200 OK", StatusCode: http.StatusOK, Header: http.Header{}, Request: req,
+		ContentLength: int64(len(helloword)) + 1, Body: ioutil.NopCloser(strings.NewReader(helloword))}, nil
+}
+
+func TestTruncated(t *testing.T) {
+	tDump, err := Wikidump{}.With(
+		WithRoundTrippers(func(http.RoundTripper) http.RoundTripper { return truncatingRoundTripper{} }),
+		WithChecksumVerification(false),
+		WithRetryPolicy(2, time.Millisecond, time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	err = tDump.stubbornly(context.Background(), "http://example.org/helloword", func() error {
+		return tDump.fetch(context.Background(), fileInfo{URL: "http://example.org/helloword"}, ioutil.Discard)
+	})
+	if !errors.Is(err, ErrTruncated) || isPermanent(err) {
+		t.Error("A truncated download should be retried and reported with ErrTruncated, while it returns ", err)
+	}
+}
+
+func TestStatusErrors(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/missing.gz":
+			http.Error(w, "no such file", http.StatusNotFound)
+		case "/busy.gz":
+			http.Error(w, "try later", http.StatusTooManyRequests)
+		default:
+			http.Error(w, "<html>oops</html>", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	tDump := Wikidump{}
+	for name, retriable := range map[string]bool{"/missing.gz": false, "/busy.gz": true, "/down.gz": true} {
+		err := tDump.fetch(context.Background(), fileInfo{URL: server.URL + name}, ioutil.Discard)
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) {
+			t.Fatal("fetch should return a StatusError, while it returns ", err)
+		}
+		if !strings.Contains(err.Error(), statusErr.Status) || statusErr.Body == "" {
+			t.Error("The error should report the status and the body, while it's ", err)
+		}
+		if tDump.retriable(err, 1) != retriable {
+			t.Error("The error for", name, "should be retriable:", retriable)
+		}
+	}
+
+	//permanent errors are not retried
+	mu.Lock()
+	requests = 0
+	mu.Unlock()
+	start := time.Now()
+	if _, err := tDump.stubbornStore(context.Background(), fileInfo{URL: server.URL + "/missing.gz"}); err == nil {
+		t.Error("Error should be not null")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if time.Since(start) > time.Second || requests != 1 {
+		t.Error("A 404 should not be retried, while it's requested", requests, "times")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for value, expected := range map[string]time.Duration{
+		"120":                           2 * time.Minute,
+		"Wed, 01 Jan 2020 00:00:30 GMT": 30 * time.Second,
+		"Tue, 31 Dec 2019 23:59:00 GMT": 0,
+		"-5":                            0,
+		"soon":                          0,
+		"":                              0,
+	} {
+		if d := parseRetryAfter(value, now); d != expected {
+			t.Errorf("parseRetryAfter(%q) returns %v, while it should return %v", value, d, expected)
+		}
+	}
+
+	var mu sync.Mutex
+	var attempts []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if attempts = append(attempts, time.Now()); len(attempts) == 1 {
+			w.Header().Set("Retry-After", "2")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		w.Write(name2MyInfo["/helloword.gz"].Data)
+	}))
+	defer server.Close()
+
+	r, err := Wikidump{}.stubbornStore(context.Background(), fileInfo{URL: server.URL + "/helloword.gz", SHA1: name2MyInfo["/helloword.gz"].SHA1})
+	if err != nil {
+		t.Fatal("stubbornStore returns ", err)
+	}
+	r.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(attempts) != 2 || attempts[1].Sub(attempts[0]) < 2*time.Second {
+		t.Error("The retry should wait for the time requested by Retry-After, while attempts are at ", attempts)
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	agents := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents <- r.Header.Get("User-Agent")
+	}))
+	defer server.Close()
+
+	if _, err := (Wikidump{}).With(WithUserAgent("")); err == nil {
+		t.Error("An empty User-Agent should be invalid")
+	}
+	custom, err := Wikidump{}.With(WithUserAgent("negapedia/2.0 (contact@example.org)"))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	overridden, err := custom.With(WithHeadersFor(func(string) http.Header { return http.Header{"User-Agent": {"override"}} }))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	for expected, tDump := range map[string]Wikidump{UserAgent: {}, "negapedia/2.0 (contact@example.org)": custom, "override": overridden} {
+		r, err := tDump.stream(context.Background(), fileInfo{URL: server.URL + "/helloword.gz"})
+		if err != nil {
+			t.Fatal("stream returns ", err)
+		}
+		r.Close()
+		if agent := <-agents; agent != expected {
+			t.Errorf("The request should have User-Agent %q, while it has %q", expected, agent)
+		}
+	}
+}
+
+func TestDNSErrors(t *testing.T) {
+	nxdomain := &url.Error{Op: "Get", URL: "https://nowhere.invalid", Err: &net.OpError{Op: "dial", Net: "tcp",
+		Err: &net.DNSError{Err: "no such host", Name: "nowhere.invalid", IsNotFound: true}}}
+	temporary := &url.Error{Op: "Get", URL: "https://dumps.wikimedia.org", Err: &net.OpError{Op: "dial", Net: "tcp",
+		Err: &net.DNSError{Err: "i/o timeout", Name: "dumps.wikimedia.org", IsTimeout: true, IsTemporary: true}}}
+
+	tDump, err := Wikidump{}.With(WithBeforeAttempt(func(ctx context.Context, url string, attempt int) error {
+		if attempt > 2 {
+			return errors.New("too many attempts")
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+
+	for _, test := range []struct {
+		err      *url.Error
+		attempts int
+		notFound bool
+	}{{nxdomain, 1, true}, {temporary, 2, false}} {
+		attempts := 0
+		err := tDump.stubbornly(context.Background(), test.err.URL, func() error {
+			attempts++
+			return requestError(test.err, test.err.URL)
+		})
+		if errors.Is(err, ErrHostNotFound) != test.notFound {
+			t.Error("Unexpected error for", test.err, ":", err)
+		}
+		if attempts != test.attempts {
+			t.Error(test.err, "should be attempted", test.attempts, "times, while it's attempted", attempts, "times")
+		}
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("corrupted"))
+	}))
+	defer server.Close()
+
+	var attempts []int
+	tDump, err := Wikidump{}.With(WithShouldRetry(func(err error, attempt int) bool {
+		attempts = append(attempts, attempt)
+		return !strings.Contains(err.Error(), "mismatched SHA1")
+	}))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+
+	fi := fileInfo{URL: server.URL + "/helloword.gz", SHA1: name2MyInfo["/helloword.gz"].SHA1}
+	if _, err := tDump.stubbornStore(context.Background(), fi); err == nil || !strings.Contains(err.Error(), "mismatched SHA1") {
+		t.Error("stubbornStore should return the SHA1 mismatch, while it returns ", err)
+	}
+	if !reflect.DeepEqual(attempts, []int{1}) {
+		t.Error("The predicate should be consulted only after the first attempt, while it's consulted after", attempts)
+	}
+}
+
+func TestOpenDecompressedRange(t *testing.T) {
+	ffi := make([]fileInfo, 0, len(name2MyInfo))
+	for name, info := range name2MyInfo {
+		ffi = append(ffi, fileInfo{URL: "http://" + address + name, SHA1: info.SHA1})
+	}
+	tDump := Wikidump{file2Info: map[string][]fileInfo{"helloword": ffi}}
+	content := strings.Repeat(helloword, len(ffi))
+
+	for _, rng := range [][2]int64{{7, 20}, {0, 5}, {30, 39}, {35, 100}, {100, 200}} {
+		r, err := tDump.OpenDecompressedRange(context.Background(), "helloword", rng[0], rng[1])
+		if err != nil {
+			t.Fatal("OpenDecompressedRange returns ", err)
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Error("Reading returns ", err)
+		}
+		start, end := rng[0], rng[1]
+		if end > int64(len(content)) {
+			end = int64(len(content))
+		}
+		if start > end {
+			start = end
+		}
+		if expected := content[start:end]; string(data) != expected {
+			t.Errorf("Range %v should be %q but it's %q", rng, expected, data)
+		}
+		if err := r.Close(); err != nil {
+			t.Error("Closing returns ", err)
+		}
+	}
+
+	if _, err := tDump.OpenDecompressedRange(context.Background(), "helloword", 5, 4); err == nil {
+		t.Error("Error should be not null")
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var mu sync.Mutex
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(name2MyInfo[r.URL.Path].Data)
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	tDump, err := Wikidump{}.With(WithLogger(log.New(&logs, "", 0)), WithRetryPolicy(2, time.Millisecond, time.Millisecond))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	r, err := tDump.open(context.Background(), fileInfo{URL: server.URL + "/helloword.gz", SHA1: name2MyInfo["/helloword.gz"].SHA1})
+	if err != nil {
+		t.Fatal("open returns ", err)
+	}
+	r.Close()
+	tDump.open(context.Background(), fileInfo{URL: server.URL + "/helloword.bz2", SHA1: "wrong"})
+
+	for _, expected := range []string{
+		"Attempt 1 at downloading the following url: " + server.URL + "/helloword.gz\n",
+		"Warning: attempt 1 failed for the following url: " + server.URL + "/helloword.gz, retrying in ",
+		"Attempt 2 at downloading the following url: " + server.URL + "/helloword.gz\n",
+		fmt.Sprintf("Downloaded %v bytes from the following url: %v/helloword.gz\n", len(name2MyInfo["/helloword.gz"].Data), server.URL),
+		"Decompressing the following url: " + server.URL + "/helloword.gz as gzip\n",
+		"Warning: mismatched SHA1 for the following url: " + server.URL + "/helloword.bz2\n",
+	} {
+		if !strings.Contains(logs.String(), expected) {
+			t.Errorf("Logs should contain %q, while they're %q", expected, logs.String())
+		}
+	}
+}
+
+func TestTrafficLog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(name2MyInfo[r.URL.Path].Data)
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	tDump, err := Wikidump{}.With(WithTrafficLog(true), WithLogger(log.New(&logs, "", 0)))
+	if err != nil {
+		t.Fatal("With returns ", err)
+	}
+	info := name2MyInfo["/helloword.gz"]
+	if err := tDump.fetch(context.Background(), fileInfo{URL: server.URL + "/helloword.gz?token=secret", SHA1: info.SHA1}, ioutil.Discard); err != nil {
+		t.Fatal("fetch returns ", err)
+	}
+
+	expected := fmt.Sprintf("GET %v/helloword.gz: 200 OK\nDownloaded %v bytes from the following url: %v/helloword.gz\nGET %v/helloword.gz: %v bytes received\n",
+		server.URL, len(info.Data), server.URL, server.URL, len(info.Data))
+	if logs.String() != expected {
+		t.Errorf("Logs should be %q but they're %q", expected, logs.String())
+	}
+
+	//failed requests are logged without the query too
+	logs.Reset()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+	fi := fileInfo{URL: unreachable.URL + "/helloword.gz?token=secret", SHA1: info.SHA1}
+	if err := tDump.fetch(context.Background(), fi, ioutil.Discard); err == nil {
+		t.Fatal("fetch should fail for an unreachable server")
+	}
+	if strings.Contains(logs.String(), "secret") || !strings.HasPrefix(logs.String(), "GET "+unreachable.URL+"/helloword.gz: ") {
+		t.Errorf("The failed request is logged as %q", logs.String())
+	}
+}